@@ -0,0 +1,207 @@
+// Package eeprom implements a driver for 24-series (24Cxx) I2C serial EEPROMs
+// connected to the I2C bus of an MPSSE device.
+package eeprom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	mpsse "github.com/ardnew/gompsse"
+)
+
+// Model describes the memory organization of a 24-series EEPROM.
+type Model struct {
+	Size     int // total capacity in bytes
+	PageSize int // max bytes written per write cycle
+	AddrLen  int // bytes in the word address (1 or 2)
+}
+
+// Known 24-series EEPROM models. For parts whose capacity exceeds the range of
+// the word address (e.g., 24C04-24C16), the upper address bits ("block" bits)
+// occupy the low bits of the 7-bit device address.
+var (
+	Model24C01  = Model{Size: 128, PageSize: 8, AddrLen: 1}
+	Model24C02  = Model{Size: 256, PageSize: 8, AddrLen: 1}
+	Model24C04  = Model{Size: 512, PageSize: 16, AddrLen: 1}
+	Model24C08  = Model{Size: 1024, PageSize: 16, AddrLen: 1}
+	Model24C16  = Model{Size: 2048, PageSize: 16, AddrLen: 1}
+	Model24C32  = Model{Size: 4096, PageSize: 32, AddrLen: 2}
+	Model24C64  = Model{Size: 8192, PageSize: 32, AddrLen: 2}
+	Model24C128 = Model{Size: 16384, PageSize: 64, AddrLen: 2}
+	Model24C256 = Model{Size: 32768, PageSize: 64, AddrLen: 2}
+	Model24C512 = Model{Size: 65536, PageSize: 128, AddrLen: 2}
+)
+
+// Constants related to EEPROM write cycle timing
+const (
+	writeTimeoutDefault = 25 * time.Millisecond // typical max tWR is 5-10 ms
+	writePollInterval   = time.Millisecond      // delay between ACK polls
+)
+
+// ErrOutOfRange is returned when an access extends beyond the end of memory.
+var ErrOutOfRange = errors.New("access beyond end of EEPROM")
+
+// Device represents a single 24-series EEPROM on an I2C bus. Device implements
+// io.ReaderAt and io.WriterAt.
+type Device struct {
+	bus     *mpsse.I2C
+	addr    uint8
+	model   Model
+	timeout time.Duration
+}
+
+var (
+	_ io.ReaderAt = (*Device)(nil)
+	_ io.WriterAt = (*Device)(nil)
+)
+
+// New returns a driver for the EEPROM of the given model at the given 7-bit
+// base address (typically 0x50) on the I2C bus i2c.
+func New(i2c *mpsse.I2C, addr uint8, model Model) (*Device, error) {
+	if model.Size <= 0 || model.PageSize <= 0 ||
+		(1 != model.AddrLen && 2 != model.AddrLen) {
+		return nil, fmt.Errorf("invalid EEPROM model: %+v", model)
+	}
+	return &Device{
+		bus:     i2c,
+		addr:    addr,
+		model:   model,
+		timeout: writeTimeoutDefault,
+	}, nil
+}
+
+func (d *Device) String() string {
+	return fmt.Sprintf("{ Addr: 0x%02X, Model: %+v, Timeout: %s }",
+		d.addr, d.model, d.timeout)
+}
+
+// Size returns the capacity of the EEPROM in bytes.
+func (d *Device) Size() int64 {
+	return int64(d.model.Size)
+}
+
+// SetWriteTimeout sets the maximum duration to wait for the EEPROM to complete
+// an internal write cycle.
+func (d *Device) SetWriteTimeout(timeout time.Duration) {
+	d.timeout = timeout
+}
+
+// ReadAt reads len(p) bytes from the EEPROM starting at offset off. If fewer
+// than len(p) bytes remain before the end of memory, the remaining bytes are
+// read and io.EOF is returned.
+func (d *Device) ReadAt(p []byte, off int64) (int, error) {
+
+	if off < 0 {
+		return 0, fmt.Errorf("invalid EEPROM offset: %d", off)
+	}
+
+	var eof error
+	if rem := d.Size() - off; int64(len(p)) > rem {
+		if rem < 0 {
+			rem = 0
+		}
+		p, eof = p[:rem], io.EOF
+	}
+
+	n := 0
+	for n < len(p) {
+		// a sequential read may not roll over into the next block
+		end := span(off, n, len(p), d.blockSize())
+		dev, word := d.address(int(off) + n)
+		if _, err := d.bus.Write(dev, word, true, false); nil != err {
+			return n, err
+		}
+		if _, err := d.bus.Read(dev, p[n:end], true, true); nil != err {
+			return n, err
+		}
+		n = end
+	}
+
+	return n, eof
+}
+
+// WriteAt writes len(p) bytes to the EEPROM starting at offset off, splitting
+// the data on page boundaries and waiting for each page's write cycle to
+// complete. ErrOutOfRange is returned, after writing all bytes that fit, if the
+// data extends beyond the end of memory.
+func (d *Device) WriteAt(p []byte, off int64) (int, error) {
+
+	if off < 0 {
+		return 0, fmt.Errorf("invalid EEPROM offset: %d", off)
+	}
+
+	var eom error
+	if rem := d.Size() - off; int64(len(p)) > rem {
+		if rem < 0 {
+			rem = 0
+		}
+		p, eom = p[:rem], ErrOutOfRange
+	}
+
+	n := 0
+	for n < len(p) {
+		// a page write wraps around within the current page
+		end := span(off, n, len(p), d.model.PageSize)
+		dev, word := d.address(int(off) + n)
+		if _, err := d.bus.Write(dev, append(word, p[n:end]...), true, true); nil != err {
+			return n, err
+		}
+		if err := d.waitWrite(dev); nil != err {
+			return n, err
+		}
+		n = end
+	}
+
+	return n, eom
+}
+
+// span returns the end of the part of an access of length n bytes starting at
+// memory offset off, beginning at byte pos of the access, that lies within a
+// single region of the given size (a page or block).
+func span(off int64, pos int, n int, size int) int {
+	at := int(off) + pos
+	end := pos + size - at%size
+	if end > n {
+		end = n
+	}
+	return end
+}
+
+// blockSize returns the number of bytes addressable by the word address alone.
+func (d *Device) blockSize() int {
+	return 1 << uint(8*d.model.AddrLen)
+}
+
+// address returns the 7-bit device address and word address bytes used to
+// access memory offset pos.
+func (d *Device) address(pos int) (uint8, []uint8) {
+	block := uint8(pos / d.blockSize())
+	mask := uint8((d.model.Size - 1) / d.blockSize())
+	dev := (d.addr & ^mask) | (block & mask)
+	if 1 == d.model.AddrLen {
+		return dev, []uint8{uint8(pos)}
+	}
+	return dev, []uint8{uint8(pos >> 8), uint8(pos)}
+}
+
+// waitWrite polls the EEPROM at device address dev until it acknowledges its
+// address, indicating its internal write cycle is complete.
+func (d *Device) waitWrite(dev uint8) error {
+
+	deadline := time.Now().Add(d.timeout)
+	for {
+		ack, err := d.bus.Probe(dev)
+		if nil != err {
+			return err
+		}
+		if ack {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("EEPROM write cycle timeout (%s)", d.timeout)
+		}
+		time.Sleep(writePollInterval)
+	}
+}
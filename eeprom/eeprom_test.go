@@ -0,0 +1,72 @@
+package eeprom
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		model Model
+		base  uint8
+		pos   int
+		dev   uint8
+		word  []uint8
+	}{
+		{"24C02", Model24C02, 0x50, 0xAB, 0x50, []uint8{0xAB}},
+		{"24C16 block 0", Model24C16, 0x50, 0x0FF, 0x50, []uint8{0xFF}},
+		{"24C16 block 3", Model24C16, 0x50, 0x3FF, 0x53, []uint8{0xFF}},
+		{"24C16 block 7", Model24C16, 0x50, 0x7A5, 0x57, []uint8{0xA5}},
+		{"24C04 base pin", Model24C04, 0x57, 0x000, 0x56, []uint8{0x00}},
+		{"24C04 block 1", Model24C04, 0x56, 0x100, 0x57, []uint8{0x00}},
+		{"24C256", Model24C256, 0x51, 0x1234, 0x51, []uint8{0x12, 0x34}},
+	}
+
+	for _, tt := range tests {
+		d, err := New(nil, tt.base, tt.model)
+		if nil != err {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		dev, word := d.address(tt.pos)
+		if dev != tt.dev || !bytes.Equal(word, tt.word) {
+			t.Errorf("%s: got 0x%02X % X, want 0x%02X % X",
+				tt.name, dev, word, tt.dev, tt.word)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+
+	tests := []struct {
+		name string
+		off  int64
+		n    int
+		size int
+		want []int // end of each successive region
+	}{
+		{"aligned", 0, 16, 8, []int{8, 16}},
+		{"unaligned", 5, 20, 8, []int{3, 11, 19, 20}},
+		{"within page", 9, 4, 16, []int{4}},
+		{"page end", 12, 4, 16, []int{4}},
+		{"single byte", 7, 1, 8, []int{1}},
+	}
+
+	for _, tt := range tests {
+		var got []int
+		for pos := 0; pos < tt.n; pos = got[len(got)-1] {
+			got = append(got, span(tt.off, pos, tt.n, tt.size))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -3,11 +3,16 @@ package gompsse
 import (
 	"fmt"
 	"strings"
+	"sync"
 )
 
 type MPSSE struct {
 	info *deviceInfo
 	mode Mode
+	low  *gpioConfig // low-byte lines, when driven by raw MPSSE commands
+	raw  bool        // MPSSE enabled for raw commands with no serial mode
+	gen  *Generator  // waveform being generated with the MPSSE clock, if any
+	mu   sync.Mutex  // serializes device access with background goroutines
 	I2C  *I2C
 	SPI  *SPI
 	GPIO *GPIO
@@ -42,13 +47,14 @@ func NewMPSSEWithDesc(desc string) (*MPSSE, error) {
 }
 
 func NewMPSSEWithMask(mask *OpenMask) (*MPSSE, error) {
-	m := &MPSSE{info: nil, mode: ModeNone, I2C: nil, SPI: nil}
+	m := &MPSSE{info: nil, mode: ModeNone, low: &gpioConfig{}, I2C: nil, SPI: nil}
 	if err := m.openDevice(mask); nil != err {
 		return nil, err
 	}
-	m.I2C = &I2C{device: m, config: i2cConfigDefault()}
+	m.I2C = &I2C{device: m, config: i2cConfigDefault(), seg: &i2cSegment{}}
 	m.SPI = &SPI{device: m, config: spiConfigDefault()}
-	m.GPIO = &GPIO{device: m, config: gpioConfigDefault()}
+	m.SPI.queue.init()
+	m.GPIO = &GPIO{device: m, config: gpioConfigDefault(), watch: watchOptionsDefault()}
 	if err := m.GPIO.Init(); nil != err {
 		return nil, err
 	}
@@ -131,10 +137,10 @@ func (m *MPSSE) openDevice(mask *OpenMask) error {
 }
 
 func (m *MPSSE) Close() error {
+	m.mode, m.raw = ModeNone, false
 	if nil != m.info {
 		return m.info.close()
 	}
-	m.mode = ModeNone
 	return nil
 }
 
@@ -200,6 +206,17 @@ func (dev *deviceInfo) String() string {
 		dev.vid, dev.pid, dev.locID, dev.serial, dev.desc, dev.handle)
 }
 
+// isHiSpeedMPSSE returns true if the device contains the Hi-Speed MPSSE found
+// in the H-series chips (FT2232H, FT4232H, FT232H).
+func (dev *deviceInfo) isHiSpeedMPSSE() bool {
+	switch dev.chip {
+	case FT2232H, FT4232H, FT232H:
+		return true
+	default:
+		return false
+	}
+}
+
 func (dev *deviceInfo) open() error {
 	if ce := dev.close(); nil != ce {
 		return ce
@@ -241,11 +258,21 @@ func devices() ([]*deviceInfo, error) {
 	return info, nil
 }
 
+// gpioConfig holds the direction and output latch of a byte of MPSSE lines.
+// The latch of an input pin is retained (but not driven) so that the pin takes
+// on its latched level if later made an output.
 type gpioConfig struct {
 	dir uint8
 	val uint8
 }
 
+// set sets the direction of the lines in dirMask and the output latch of those
+// in valMask, leaving all other lines unchanged.
+func (cfg *gpioConfig) set(dirMask uint8, dir uint8, valMask uint8, val uint8) {
+	cfg.dir = (cfg.dir & ^dirMask) | (dir & dirMask)
+	cfg.val = (cfg.val & ^valMask) | (val & valMask)
+}
+
 func gpioConfigDefault() *gpioConfig {
 	return &gpioConfig{
 		dir: 0xFF, // each bit set, all pins OUTPUT by default
@@ -253,53 +280,76 @@ func gpioConfigDefault() *gpioConfig {
 	}
 }
 
+// GPIO provides access to the MPSSE high-byte lines (port "C" on FT232H), and
+// to any low-byte lines (port "D") not in use by SPI or I2C. The direction and
+// output latch of each pin are tracked separately from the levels last read
+// from its input, so reading inputs never affects the outputs.
 type GPIO struct {
 	device *MPSSE
 	config *gpioConfig
+	input  uint8 // high-byte levels last read
+	inputD uint8 // low-byte levels last read
+	watch  WatchOptions
 }
 
 func (gpio *GPIO) Init() error {
 	return gpio.Write(gpio.config.dir, gpio.config.val)
 }
 
+// Write sets the direction and output latch of all high-byte lines. Only the
+// latched levels of output pins are driven.
 func (gpio *GPIO) Write(dir uint8, val uint8) error {
+	return gpio.update(0xFF, dir, 0xFF, val)
+}
 
-	val &= dir // only set output bits
+// update sets the direction of the high-byte lines in dirMask and the output
+// latch of those in valMask, leaving all other lines unchanged. The state is
+// read, written and committed under the device lock, so that a waveform built
+// from it concurrently cannot undo the change.
+func (gpio *GPIO) update(dirMask uint8, dir uint8, valMask uint8, val uint8) error {
 
-	if err := _FT_WriteGPIO(gpio, dir, val); nil != err {
+	m := gpio.device
+	m.lock()
+	defer m.mu.Unlock()
+
+	if err := m.enable(); nil != err {
 		return err
 	}
 
-	gpio.config.dir = dir
-	gpio.config.val = val
+	cfg := *gpio.config
+	cfg.set(dirMask, dir, valMask, val)
+	if err := _FT_WriteGPIO(gpio, cfg.dir, cfg.val&cfg.dir); nil != err {
+		return err
+	}
 
+	*gpio.config = cfg
 	return nil
 }
 
+// Read samples and returns the levels of all high-byte lines. The output latch
+// is not affected.
 func (gpio *GPIO) Read() (uint8, error) {
 
-	val, err := _FT_ReadGPIO(gpio)
+	gpio.device.lock()
+	err := gpio.device.enable()
+	var val uint8
+	if nil == err {
+		val, err = _FT_ReadGPIO(gpio)
+	}
+	gpio.device.mu.Unlock()
 	if nil != err {
 		return 0, err
 	}
 
-	gpio.config.val = val
+	gpio.input = val
 
 	return val, nil
 }
 
+// Set sets the output latch of the given pin, as for Output. The direction of
+// the pin is not changed; use SetDirection to make it an output.
 func (gpio *GPIO) Set(pin CPin, val bool) error {
-
-	dir := gpio.config.dir | uint8(pin)
-	set := gpio.config.val
-
-	if val {
-		set |= uint8(pin)
-	} else {
-		set &= ^uint8(pin)
-	}
-
-	return gpio.Write(dir, set)
+	return gpio.Output(pin, val)
 }
 
 func (gpio *GPIO) Get(pin CPin) (bool, error) {
@@ -311,3 +361,55 @@ func (gpio *GPIO) Get(pin CPin) (bool, error) {
 
 	return (set & uint8(pin)) > 0, nil
 }
+
+// SetDirection configures the given pin as an output (driving its latched
+// level) or as an input.
+func (gpio *GPIO) SetDirection(pin CPin, output bool) error {
+	var dir uint8
+	if output {
+		dir = uint8(pin)
+	}
+	return gpio.update(uint8(pin), dir, 0, 0)
+}
+
+// Output sets the output latch of the given pin. The level is driven only if
+// the pin is an output; an input pin remains an input, taking on the latched
+// level once made an output with SetDirection.
+func (gpio *GPIO) Output(pin CPin, level bool) error {
+	var val uint8
+	if level {
+		val = uint8(pin)
+	}
+	return gpio.update(0, 0, uint8(pin), val)
+}
+
+// drive configures the given pin as an output driving level, setting its
+// direction and output latch with a single write.
+func (gpio *GPIO) drive(pin CPin, level bool) error {
+	var val uint8
+	if level {
+		val = uint8(pin)
+	}
+	return gpio.update(uint8(pin), uint8(pin), uint8(pin), val)
+}
+
+// Input samples the high-byte lines and returns the level of the given pin.
+func (gpio *GPIO) Input(pin CPin) (bool, error) {
+	return gpio.Get(pin)
+}
+
+// IsOutput returns true if the given pin is configured as an output.
+func (gpio *GPIO) IsOutput(pin CPin) bool {
+	return 0 != gpio.config.dir&uint8(pin)
+}
+
+// Latched returns the level of the output latch of the given pin.
+func (gpio *GPIO) Latched(pin CPin) bool {
+	return 0 != gpio.config.val&uint8(pin)
+}
+
+// LastInput returns the level of the given pin when the high-byte lines were
+// last read, without sampling them again.
+func (gpio *GPIO) LastInput(pin CPin) bool {
+	return 0 != gpio.input&uint8(pin)
+}
@@ -0,0 +1,352 @@
+package gompsse
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Constants related to waveforms generated continuously by a Generator.
+const (
+	genClock = D0 // TCK/SCLK, the only line the MPSSE clock can drive
+
+	// duration of each chunk of waveform sent to the device, and the number
+	// of chunks kept queued ahead of the one being generated
+	genChunkTime = 20 * time.Millisecond
+	genChunkLead = 2
+
+	// rate (bytes per second) at which waveform commands can be sustained over
+	// USB by Hi-Speed and Full-Speed devices, conservatively below the bulk
+	// transfer limit of each
+	genByteRateHiSpeed   = 8000000
+	genByteRateFullSpeed = 800000
+)
+
+// genWave appends to cmd one chunk of a waveform, using the current state low
+// and high of the GPIO lines for any line it does not generate.
+type genWave func(cmd *mpsseCmd, low *gpioConfig, high *gpioConfig)
+
+// Generator is a waveform (a clock or PWM signal) generated continuously by
+// the MPSSE, as started by GPIO.ClockOut or GPIO.PWM. The waveform is sent to
+// the device in chunks from a background goroutine that keeps the device's
+// command queue filled, so that there are no gaps between chunks, while other
+// operations can still be performed between them.
+type Generator struct {
+	device *MPSSE
+	freq   float64
+	duty   float64
+	stop   chan struct{}
+	once   sync.Once // stops the generator, only on the first call to Stop
+	done   chan struct{}
+	err    error
+}
+
+// Frequency returns the frequency (in Hertz) actually generated, which may
+// differ from that requested since it is derived from the MPSSE clock.
+func (g *Generator) Frequency() float64 {
+	return g.freq
+}
+
+// Duty returns the duty cycle (0-1) actually generated.
+func (g *Generator) Duty() float64 {
+	return g.duty
+}
+
+// Stop stops generating the waveform. Any part of the waveform still queued in
+// the device is canceled by purging and resetting the MPSSE, after which the
+// pin(s) return to their idle state, and another waveform may be started.
+// Returns the error that stopped the waveform early, if any. Calling Stop again
+// has no effect and returns the same error.
+func (g *Generator) Stop() error {
+	g.once.Do(func() {
+		close(g.stop)
+		<-g.done
+		m := g.device
+		m.lock()
+		err := m.abort()
+		m.gen = nil
+		m.mu.Unlock()
+		if nil != err && nil == g.err {
+			g.err = err
+		}
+	})
+	return g.err
+}
+
+// ClockOut continuously generates a 50% duty cycle clock on TCK/SCLK (D0) at
+// the MPSSE clock rate nearest to freq, using clock-only commands. Only
+// possible when no serial mode is active. The fixed-frequency clock outputs
+// available on the FT232H ACBUS pins are selected in its EEPROM instead, and
+// cannot be controlled through the MPSSE.
+func (gpio *GPIO) ClockOut(freq uint32) (*Generator, error) {
+
+	clk, err := gpio.genClock(freq)
+	if nil != err {
+		return nil, err
+	}
+
+	cycles := int(math.Ceil(clk.rate * genChunkTime.Seconds()))
+	if cycles < 8 {
+		cycles = 8
+	}
+
+	setup := func(low *gpioConfig, high *gpioConfig) {
+		low.dir |= uint8(genClock)
+		low.val &= ^uint8(genClock)
+	}
+	wave := func(cmd *mpsseCmd, low *gpioConfig, high *gpioConfig) {
+		cmd.clockOnly(cycles)
+	}
+
+	return gpio.generate(clk, setup, wave,
+		time.Duration(float64(cycles)/clk.rate*float64(time.Second)), clk.rate, 0.5)
+}
+
+// PWM continuously generates a pulse-width modulated signal on the given MPSSE
+// pin (as returned by MPSSE.Pin), which cannot be TCK/SCLK (D0), with the given
+// frequency and duty cycle (0-1). The pin is written high at the start of each
+// period and low once the duty cycle has elapsed, with both parts timed by
+// clock-only commands on TCK/SCLK (D0), which toggles if configured as an
+// output. Each write is made from the current
+// state of the other lines on the same port, which may still be changed while
+// generating. The estimated execution time of each command is deducted from the
+// period, and Frequency and Duty report the resulting waveform. A frequency too
+// high for its commands to be sent over USB without gaps is rejected. Only
+// possible when no serial mode is active.
+func (gpio *GPIO) PWM(pin Pin, freq float64, duty float64) (*Generator, error) {
+
+	if freq <= 0 {
+		return nil, fmt.Errorf("invalid frequency: %g", freq)
+	}
+	if duty < 0 || duty > 1 {
+		return nil, fmt.Errorf("invalid duty cycle: %g", duty)
+	}
+
+	var (
+		mask uint8
+		high bool
+	)
+
+	switch p := pin.(type) {
+	case *cPin:
+		mask, high = uint8(p.pin), true
+	case *dPin:
+		if 0 != p.pin&genClock {
+			return nil, fmt.Errorf("PWM not possible on TCK/SCLK (D0)")
+		}
+		mask = uint8(p.pin)
+	default:
+		return nil, fmt.Errorf("pin not on MPSSE: %s", pin.Name())
+	}
+
+	// time the PWM with the fastest clock, for the finest resolution
+	hiSpeed := gpio.device.info.isHiSpeedMPSSE()
+	max, rate := uint32(spiClockMaximum), float64(genByteRateHiSpeed)
+	if !hiSpeed {
+		max, rate = 6000000, genByteRateFullSpeed
+	}
+	clk, err := gpio.genClock(max)
+	if nil != err {
+		return nil, err
+	}
+
+	// split the period into the part with the pin high and the part with it
+	// low, each begun by a write to the pin; a part shorter than half of the
+	// time taken by that write is omitted
+	oh := mpsseSetByteTime.Seconds() * clk.rate
+	period := clk.rate / freq
+	on, onTime := genPart(duty*period, oh)
+	off, offTime := genPart((1-duty)*period, oh)
+	actual := onTime + offTime
+	if 0 == actual || actual > period+oh/2 {
+		return nil, fmt.Errorf("frequency too high: %g", freq)
+	}
+
+	set := func(cmd *mpsseCmd, low *gpioConfig, hi *gpioConfig, level bool) {
+		cfg := low
+		if high {
+			cfg = hi
+		}
+		val, dir := cfg.val & ^mask, cfg.dir|mask
+		if level {
+			val |= mask
+		}
+		if high {
+			cmd.setHigh(val&dir, dir)
+		} else {
+			cmd.setLow(val&dir, dir, 1)
+		}
+	}
+
+	// repeat the period enough times to fill a chunk
+	n := int(math.Ceil(genChunkTime.Seconds() * clk.rate / actual))
+	if n < 1 {
+		n = 1
+	}
+
+	setup := func(low *gpioConfig, hi *gpioConfig) {
+		cfg := low
+		if high {
+			cfg = hi
+		}
+		cfg.dir |= mask
+		cfg.val &= ^mask
+	}
+	wave := func(cmd *mpsseCmd, low *gpioConfig, hi *gpioConfig) {
+		for i := 0; i < n; i++ {
+			if onTime > 0 {
+				set(cmd, low, hi, true)
+				cmd.clockOnly(on)
+			}
+			if offTime > 0 {
+				set(cmd, low, hi, false)
+				cmd.clockOnly(off)
+			}
+		}
+	}
+
+	dur := float64(n) * actual / clk.rate
+	chunk := &mpsseCmd{}
+	wave(chunk, &gpioConfig{}, &gpioConfig{})
+	if float64(len(chunk.buf))/dur > rate {
+		return nil, fmt.Errorf("frequency too high to sustain over USB: %g", freq)
+	}
+
+	return gpio.generate(clk, setup, wave,
+		time.Duration(dur*float64(time.Second)), clk.rate/actual, onTime/actual)
+}
+
+// genPart returns the clock-only cycles which, together with the write to the
+// pin beginning it, make one part of a PWM period last target MPSSE clock
+// cycles, given that each command takes oh cycles to execute in addition to any
+// it clocks, along with the cycles the part actually lasts. The part is omitted
+// (both are 0) if target is shorter than half of the write.
+func genPart(target float64, oh float64) (int, float64) {
+	if target < oh/2 {
+		return 0, 0
+	}
+	// try each number of clock-only commands the part could need, keeping the
+	// cycles giving the duration nearest to target
+	best, actual := 0, oh
+	for c := 0; c <= clockOnlyCmds(int(target))+1; c++ {
+		n := int(math.Round(target - oh*float64(1+c)))
+		if n < 0 {
+			n = 0
+		}
+		d := float64(n) + oh*float64(1+clockOnlyCmds(n))
+		if math.Abs(d-target) < math.Abs(actual-target) {
+			best, actual = n, d
+		}
+	}
+	return best, actual
+}
+
+// clockOnlyCmds returns the number of commands appended by clockOnly for n
+// cycles.
+func clockOnlyCmds(n int) int {
+	c := (n/8 + mpsseMaxXferBytes - 1) / mpsseMaxXferBytes
+	if 0 != n%8 {
+		c++
+	}
+	return c
+}
+
+// genClock returns the MPSSE clock setting nearest to freq, verifying that no
+// serial mode (which needs the MPSSE clock for itself) is active.
+func (gpio *GPIO) genClock(freq uint32) (spiClock, error) {
+	if ModeNone != gpio.device.mode {
+		return spiClock{}, fmt.Errorf("clock generation not possible in %s mode",
+			gpio.device.mode)
+	}
+	if 0 == freq || freq > spiClockMaximum {
+		return spiClock{}, fmt.Errorf("invalid clock rate: %d", freq)
+	}
+	return spiClockDivisor(gpio.device.info, freq, ClockNearest)
+}
+
+// generate enables the MPSSE if needed, programs its clock, and applies setup
+// to the initial line states, and then starts a goroutine sending chunks of
+// the waveform, each generating it for duration dur, to the device
+// continuously. Only one waveform can be generated at a time, since each
+// programs the MPSSE clock for itself.
+func (gpio *GPIO) generate(clk spiClock, setup func(low *gpioConfig, high *gpioConfig),
+	wave genWave, dur time.Duration, freq float64, duty float64) (*Generator, error) {
+
+	m := gpio.device
+	m.lock()
+	defer m.mu.Unlock()
+
+	if nil != m.gen {
+		return nil, fmt.Errorf("waveform already being generated")
+	}
+	if err := m.enable(); nil != err {
+		return nil, err
+	}
+
+	low, high := *m.low, *gpio.config
+	setup(&low, &high)
+
+	cmd := &mpsseCmd{}
+	cmd.setClock(clk.div5, clk.div, m.info.isHiSpeedMPSSE())
+	cmd.setLow(low.val&low.dir, low.dir, 1)
+	cmd.setHigh(high.val&high.dir, high.dir)
+	if err := m.send(cmd); nil != err {
+		return nil, err
+	}
+	*m.low = low
+	*gpio.config = high
+
+	g := &Generator{
+		device: m,
+		freq:   freq,
+		duty:   duty,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	m.gen = g
+	go g.run(wave, dur)
+
+	return g, nil
+}
+
+// run sends a chunk of the waveform to the device whenever less than
+// genChunkLead chunks remain queued, until stopped or an error occurs.
+func (g *Generator) run(wave genWave, dur time.Duration) {
+
+	defer close(g.done)
+
+	lead := genChunkLead * dur
+	end := time.Now() // estimated time at which the queued waveform ends
+
+	for {
+		now := time.Now()
+		if end.Before(now) {
+			end = now
+		}
+		if end.Sub(now) < lead {
+			if err := g.send(wave); nil != err {
+				g.err = err
+				return
+			}
+			end = end.Add(dur)
+			continue
+		}
+		select {
+		case <-g.stop:
+			return
+		case <-time.After(end.Sub(now) - lead + dur/2):
+		}
+	}
+}
+
+// send builds a chunk of the waveform from the current state of the GPIO lines
+// and sends it to the device.
+func (g *Generator) send(wave genWave) error {
+	m := g.device
+	m.lock()
+	defer m.mu.Unlock()
+	cmd := &mpsseCmd{}
+	wave(cmd, m.low, m.GPIO.config)
+	return m.send(cmd)
+}
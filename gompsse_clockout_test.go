@@ -0,0 +1,32 @@
+package gompsse
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGenPart(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		target float64
+		oh     float64
+		n      int
+		actual float64
+	}{
+		{"omitted", 0.4, 1, 0, 0},
+		{"write only", 0.6, 1, 0, 1},
+		{"no overhead", 100, 0, 100, 100},
+		{"bits", 9, 1.5, 6, 9},
+		{"bytes and bits", 20, 1, 17, 20},
+		{"nearest", 100, 1.5, 96, 99},
+		{"bytes", 100, 2, 96, 100},
+	}
+
+	for _, tt := range tests {
+		n, actual := genPart(tt.target, tt.oh)
+		if n != tt.n || math.Abs(actual-tt.actual) > 1e-9 {
+			t.Errorf("%s: got (%d, %g), want (%d, %g)", tt.name, n, actual, tt.n, tt.actual)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package gompsse
+
+import (
+	"fmt"
+	"time"
+)
+
+// gpioWaitPin is the low-byte line GPIOL1, whose level the MPSSE command
+// processor can wait on.
+const gpioWaitPin = D5
+
+// reservedLow returns the mask of low-byte lines in use by the active mode,
+// which cannot be used as GPIO. In SPI mode, this includes the CS line of the
+// bus and of every device handle, so that none is asserted by a GPIO write.
+func (m *MPSSE) reservedLow() uint8 {
+	switch m.mode {
+	case ModeSPI:
+		mask := uint8(spiSCLK|spiMOSI|spiMISO) | m.SPI.csPins()
+		if SPIReadyNone != m.SPI.hw.ready {
+			mask |= uint8(spiReady)
+		}
+		return mask
+	case ModeI2C:
+		return uint8(i2cSCL | i2cSDAOut | i2cSDAIn)
+	default:
+		return 0
+	}
+}
+
+// WriteD sets the direction and output latch of the low-byte lines in mask, leaving
+// all other lines (including those in use by SPI or I2C) unchanged. An error is
+// returned if mask includes a line in use by the active mode.
+//
+// In I2C mode, libMPSSE overwrites every low-byte line during each transfer, so
+// the lines in mask only hold their state between transfers: they are restored
+// after each transfer ending with a stop condition or failing, and are not
+// reliable between a start condition and the matching stop.
+func (gpio *GPIO) WriteD(mask DPin, dir uint8, val uint8) error {
+	return gpio.updateD(uint8(mask), dir, uint8(mask), val)
+}
+
+// updateD sets the direction of the low-byte lines in dirMask and the output
+// latch of those in valMask, leaving all other lines unchanged, under the
+// device lock as for update.
+func (gpio *GPIO) updateD(dirMask uint8, dir uint8, valMask uint8, val uint8) error {
+
+	m := gpio.device
+	m.lock()
+	defer m.mu.Unlock()
+
+	if res := m.reservedLow() & (dirMask | valMask); 0 != res {
+		return fmt.Errorf("pins in use by %s: 0x%02X", m.mode, res)
+	}
+	if err := m.enable(); nil != err {
+		return err
+	}
+
+	low := *m.low
+	low.set(dirMask, dir, valMask, val)
+	cmd := &mpsseCmd{}
+	cmd.setLow(low.val&low.dir, low.dir, 1)
+	if err := m.send(cmd); nil != err {
+		return err
+	}
+
+	*m.low = low
+	return nil
+}
+
+// ReadD samples and returns the levels of all low-byte lines.
+func (gpio *GPIO) ReadD() (uint8, error) {
+
+	cmd := &mpsseCmd{}
+	cmd.getLow()
+	val, err := gpio.device.exec(cmd)
+	if nil != err {
+		return 0, err
+	}
+
+	gpio.inputD = val[0]
+
+	return val[0], nil
+}
+
+// SetD sets the output latch of the given low-byte pin, as for OutputD. The
+// direction of the pin is not changed; use SetDirectionD to make it an output.
+func (gpio *GPIO) SetD(pin DPin, val bool) error {
+	return gpio.OutputD(pin, val)
+}
+
+// SetDirectionD configures the given low-byte pin as an output (driving its
+// latched level) or as an input.
+func (gpio *GPIO) SetDirectionD(pin DPin, output bool) error {
+	var dir uint8
+	if output {
+		dir = uint8(pin)
+	}
+	return gpio.updateD(uint8(pin), dir, 0, 0)
+}
+
+// OutputD sets the output latch of the given low-byte pin. The level is driven
+// only if the pin is an output.
+func (gpio *GPIO) OutputD(pin DPin, level bool) error {
+	var val uint8
+	if level {
+		val = uint8(pin)
+	}
+	return gpio.updateD(0, 0, uint8(pin), val)
+}
+
+// driveD configures the given low-byte pin as an output driving level, setting
+// its direction and output latch with a single write.
+func (gpio *GPIO) driveD(pin DPin, level bool) error {
+	var val uint8
+	if level {
+		val = uint8(pin)
+	}
+	return gpio.WriteD(pin, uint8(pin), val)
+}
+
+// InputD samples the low-byte lines and returns the level of the given pin.
+func (gpio *GPIO) InputD(pin DPin) (bool, error) {
+	return gpio.GetD(pin)
+}
+
+// IsOutputD returns true if the given low-byte pin is configured as an output.
+func (gpio *GPIO) IsOutputD(pin DPin) bool {
+	return 0 != gpio.device.low.dir&uint8(pin)
+}
+
+// LatchedD returns the level of the output latch of the given low-byte pin.
+func (gpio *GPIO) LatchedD(pin DPin) bool {
+	return 0 != gpio.device.low.val&uint8(pin)
+}
+
+// LastInputD returns the level of the given low-byte pin when the low-byte
+// lines were last read, without sampling them again.
+func (gpio *GPIO) LastInputD(pin DPin) bool {
+	return 0 != gpio.inputD&uint8(pin)
+}
+
+// GetD returns the level of the given low-byte pin.
+func (gpio *GPIO) GetD(pin DPin) (bool, error) {
+
+	set, err := gpio.ReadD()
+	if nil != err {
+		return false, err
+	}
+
+	return (set & uint8(pin)) > 0, nil
+}
+
+// WaitFor waits at most timeout for GPIOL1 (D5), which must be an input, to
+// reach the given level, returning ErrTimeout if it does not. The wait is
+// performed by the MPSSE itself, followed by a read-back marker that is
+// returned to the host as soon as the wait completes, so the latency is that of
+// a single USB transfer rather than of polling. On timeout, the pending wait is
+// canceled by purging and resetting the MPSSE, after which the state of the
+// active mode is restored.
+func (gpio *GPIO) WaitFor(level bool, timeout time.Duration) error {
+
+	if 0 != gpio.device.low.dir&uint8(gpioWaitPin) {
+		return fmt.Errorf("GPIOL1 (D5) configured as output")
+	}
+
+	cmd := &mpsseCmd{}
+	if level {
+		cmd.append(mpsseWaitIOHigh)
+	} else {
+		cmd.append(mpsseWaitIOLow)
+	}
+	cmd.getLow() // marker
+
+	_, err := gpio.device.execTimeout(cmd, timeout)
+	return err
+}
+
+// restoreLow rewrites the low-byte GPIO lines after libMPSSE, which overwrites
+// all low-byte lines (see i2cLowLib), has performed an I2C transfer ending with
+// a stop condition. Nothing is sent if the GPIO lines are unchanged.
+func (i2c *I2C) restoreLow() error {
+	val, dir := i2c.gpioLow()
+	res := uint8(i2cSCL | i2cSDAOut | i2cSDAIn)
+	if dir == i2cLowLib.dir & ^res && val == i2cLowLib.val & ^res {
+		return nil
+	}
+	return i2c.writeLow()
+}
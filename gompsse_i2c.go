@@ -3,6 +3,8 @@ package gompsse
 // #include "libMPSSE_i2c.h"
 import "C"
 
+import "fmt"
+
 // Constants controlling the various I2C communication options
 const (
 	// Generate start condition before transmitting
@@ -68,11 +70,28 @@ const (
 	i2cLatencyDefault = 16
 )
 
+// Constants related to board pins when MPSSE operating in I2C mode
+const (
+	i2cSCL    = D0 // serial clock
+	i2cSDAOut = D1 // serial data output, must be tied to D2
+	i2cSDAIn  = D2 // serial data input, must be tied to D1
+
+	i2cRecoverPulses  = 9  // SCL pulses needed to flush any partial byte + ACK
+	i2cRecoverHold    = 20 // repetitions of each pin state during recovery
+	i2cRecoverDefault = true
+)
+
+// i2cLowLib is the state in which libMPSSE leaves the low-byte lines after each
+// I2C transfer: SCL and SDA released, D4 driven LOW, and D3, D5-D7 as inputs.
+var i2cLowLib = gpioConfig{dir: uint8(D4), val: 0}
+
 // i2cConfig holds all of the configuration settings for an I2C channel
 type i2cConfig struct {
 	clockRate I2CClockRate
 	latency   uint8
 	options   uint32
+	recover   bool // attempt bus recovery when a transfer fails
+	active    bool // transaction in progress: started, no stop yet
 }
 
 func i2cConfigDefault() *i2cConfig {
@@ -80,6 +99,7 @@ func i2cConfigDefault() *i2cConfig {
 		clockRate: i2cClockDefault,
 		latency:   i2cLatencyDefault,
 		options:   i2cDriveOnlyZeroDefault | i2c3PhaseClockingDefault,
+		recover:   i2cRecoverDefault,
 	}
 }
 
@@ -87,4 +107,290 @@ func i2cConfigDefault() *i2cConfig {
 type I2C struct {
 	device *MPSSE
 	config *i2cConfig
+	route  *i2cRoute   // downstream mux channel, nil if physical bus
+	seg    *i2cSegment // bus segment reached, shared with muxes on it
+}
+
+func (i2c *I2C) Init() error {
+
+	i2c.device.lock()
+	defer i2c.device.mu.Unlock()
+
+	return i2c.init()
+}
+
+// init initializes the I2C channel and resets GPIO. The caller must hold the
+// device lock.
+func (i2c *I2C) init() error {
+
+	if err := _I2C_InitChannel(i2c); nil != err {
+		return err
+	}
+
+	i2c.device.mode = ModeI2C
+	*i2c.device.low = i2cLowLib
+	i2c.config.active = false
+
+	gpio := i2c.device.GPIO // reset GPIO
+	return _FT_WriteGPIO(gpio, gpio.config.dir, gpio.config.val&gpio.config.dir)
+}
+
+// SetAutoRecover enables or disables automatic bus recovery. When enabled and a
+// transfer beginning a new transaction fails (including with a NACK), the I2C
+// lines are checked and, if SDA is stuck low, the bus is recovered and the
+// transfer retried. Nothing is checked while transfers succeed, nor after a
+// failure in the middle of a transaction (e.g., at a repeated start), so that
+// the lines are never released between a transfer and its repeated start.
+func (i2c *I2C) SetAutoRecover(enable bool) {
+	i2c.config.recover = enable
+}
+
+// Probe reports whether a device acknowledges 7-bit address addr, by writing
+// no data between a start and a stop condition. A NACK is the expected answer
+// from a device that is absent or busy, so it is reported as false rather than
+// as an error, and no bus recovery is attempted.
+func (i2c *I2C) Probe(addr uint8) (bool, error) {
+
+	if err := i2c.route.enable(); nil != err {
+		return false, err
+	}
+
+	opt := uint32(i2cTransferOptionsBreakOnNACK |
+		i2cTransferOptionsStartBit | i2cTransferOptionsStopBit)
+	_, err := i2c.deviceWrite(addr, nil, opt)
+	if err = i2c.finish(err, true); SDeviceNotFound == err {
+		return false, nil
+	}
+	return nil == err, err
+}
+
+// Write writes data to the device at 7-bit address addr, preceded by a start
+// condition if start is true and followed by a stop condition if stop is true,
+// returning the number of bytes written. The low-byte GPIO lines (D-port) are
+// not reliable between a start and the matching stop, as libMPSSE overwrites
+// them during each transfer; they are restored once the stop is sent.
+func (i2c *I2C) Write(addr uint8, data []uint8, start bool, stop bool) (uint32, error) {
+
+	if start {
+		if err := i2c.route.enable(); nil != err {
+			return 0, err
+		}
+	}
+
+	opt := uint32(i2cTransferOptionsBreakOnNACK)
+	if start {
+		opt |= i2cTransferOptionsStartBit
+	}
+	if stop {
+		opt |= i2cTransferOptionsStopBit
+	}
+
+	fresh := start && !i2c.config.active
+	n, err := i2c.deviceWrite(addr, data, opt)
+	if nil != err && fresh && i2c.autoRecover() {
+		n, err = i2c.deviceWrite(addr, data, opt)
+	}
+	return n, i2c.finish(err, stop)
+}
+
+// Read reads len(data) bytes from the device at 7-bit address addr into data,
+// with start and stop conditions as for Write, returning the number of bytes
+// read. The low-byte GPIO lines (D-port) are not reliable between a start and
+// the matching stop, as for Write.
+func (i2c *I2C) Read(addr uint8, data []uint8, start bool, stop bool) (uint32, error) {
+
+	if start {
+		if err := i2c.route.enable(); nil != err {
+			return 0, err
+		}
+	}
+
+	opt := uint32(0)
+	if start {
+		opt |= i2cTransferOptionsStartBit
+	}
+	if stop {
+		opt |= i2cTransferOptionsStopBit | i2cTransferOptionsNACKLastByte
+	}
+
+	fresh := start && !i2c.config.active
+	n, err := i2c.deviceRead(addr, data, opt)
+	if nil != err && fresh && i2c.autoRecover() {
+		n, err = i2c.deviceRead(addr, data, opt)
+	}
+	return n, i2c.finish(err, stop)
+}
+
+// BusStuck releases both I2C lines and reports whether a slave device is still
+// holding SDA low, which prevents the master from generating any condition on
+// the bus. An error is returned if SCL is being held low.
+func (i2c *I2C) BusStuck() (bool, error) {
+
+	scl, sda, err := i2c.lines()
+	if nil != err {
+		return false, err
+	}
+	if !scl {
+		return false, fmt.Errorf("SCL held low")
+	}
+
+	return !sda, nil
+}
+
+// Recover frees an I2C bus whose SDA line is held low by a slave device that
+// was interrupted mid-transfer. The I2C lines are temporarily driven as GPIO,
+// SCL is pulsed until the slave releases SDA (at most 9 times), and a stop
+// condition is generated before the I2C channel is reinitialized.
+func (i2c *I2C) Recover() error {
+
+	if ModeI2C != i2c.device.mode {
+		return fmt.Errorf("I2C channel not initialized")
+	}
+
+	scl, sda, err := i2c.lines()
+	if nil != err {
+		return err
+	}
+	if !scl {
+		return fmt.Errorf("bus recovery failed: SCL held low")
+	}
+
+	// GPIO lines hold their state throughout, with SCL and SDA driven LOW only
+	val, dir := i2c.gpioLow()
+
+	for i := 0; !sda && i < i2cRecoverPulses; i++ {
+		cmd := &mpsseCmd{}
+		cmd.setLow(val, dir|uint8(i2cSCL), i2cRecoverHold) // SCL LOW
+		cmd.setLow(val, dir, i2cRecoverHold)               // SCL released
+		cmd.getLow()
+		in, err := i2c.device.exec(cmd)
+		if nil != err {
+			return err
+		}
+		sda = 0 != in[0]&uint8(i2cSDAIn)
+	}
+
+	if !sda {
+		return fmt.Errorf("bus recovery failed: SDA held low after %d clocks",
+			i2cRecoverPulses)
+	}
+
+	// stop condition: SDA goes HIGH while SCL is HIGH
+	cmd := &mpsseCmd{}
+	cmd.setLow(val, dir|uint8(i2cSCL|i2cSDAOut), i2cRecoverHold) // SCL LOW, SDA LOW
+	cmd.setLow(val, dir|uint8(i2cSDAOut), i2cRecoverHold)        // SCL released
+	cmd.setLow(val, dir, i2cRecoverHold)                         // SDA released
+	if _, err := i2c.device.exec(cmd); nil != err {
+		return err
+	}
+
+	// reinitializing resets the GPIO lines, which are then put back
+	low := *i2c.device.low
+	if err := i2c.Init(); nil != err {
+		return err
+	}
+	*i2c.device.low = low
+	return i2c.writeLow()
+}
+
+// autoRecover attempts bus recovery after a failed transfer if enabled and if
+// SDA is actually stuck, returning true if the bus was successfully recovered
+// and the transfer should be retried.
+func (i2c *I2C) autoRecover() bool {
+
+	if !i2c.config.recover {
+		return false
+	}
+
+	if stuck, err := i2c.BusStuck(); nil != err || !stuck {
+		return false
+	}
+
+	return nil == i2c.Recover()
+}
+
+// lines releases both I2C lines, leaving all other low-byte lines in their GPIO
+// state, and returns the level of SCL and SDA as driven by the external
+// pull-ups and any slave devices on the bus.
+func (i2c *I2C) lines() (scl bool, sda bool, err error) {
+
+	i2c.device.lock()
+	err = _FT_Purge(i2c.device)
+	i2c.device.mu.Unlock()
+	if nil != err {
+		return
+	}
+
+	val, dir := i2c.gpioLow()
+
+	cmd := &mpsseCmd{}
+	cmd.setLow(val, dir, i2cRecoverHold)
+	cmd.getLow()
+
+	in, err := i2c.device.exec(cmd)
+	if nil != err {
+		_ = i2c.writeLow() // best effort, the device is likely unusable
+		return
+	}
+
+	scl = 0 != in[0]&uint8(i2cSCL)
+	sda = 0 != in[0]&uint8(i2cSDAIn)
+	return
+}
+
+// gpioLow returns the value and direction of the low-byte lines with SCL and
+// SDA released and all other lines in their GPIO state.
+func (i2c *I2C) gpioLow() (val uint8, dir uint8) {
+	low := *i2c.device.low
+	dir = low.dir & ^uint8(i2cSCL|i2cSDAOut|i2cSDAIn)
+	return low.val & dir, dir
+}
+
+// writeLow drives the low-byte lines to their GPIO state, releasing SCL and SDA.
+func (i2c *I2C) writeLow() error {
+	val, dir := i2c.gpioLow()
+	cmd := &mpsseCmd{}
+	cmd.setLow(val, dir, 1)
+	_, err := i2c.device.exec(cmd)
+	return err
+}
+
+// readFinal completes a read transfer already in progress (i.e., one started
+// by a call to Read with stop=false), clocking in len(data) more bytes without
+// any start condition or address phase, NACKing the last byte and generating a
+// stop condition. This is needed for protocols whose read length is specified
+// by the data itself (e.g., SMBus block reads).
+func (i2c *I2C) readFinal(data []uint8) (uint32, error) {
+	opt := uint32(i2cTransferOptionsFastTransferBytes |
+		i2cTransferOptionsNoAddress | i2cTransferOptionsStopBit)
+	n, err := i2c.deviceRead(0, data, opt)
+	return n, i2c.finish(err, true)
+}
+
+// deviceWrite performs a libMPSSE I2C write with exclusive access to the device.
+func (i2c *I2C) deviceWrite(addr uint8, data []uint8, opt uint32) (uint32, error) {
+	i2c.device.lock()
+	defer i2c.device.mu.Unlock()
+	return _I2C_DeviceWrite(i2c, addr, data, opt)
+}
+
+// deviceRead performs a libMPSSE I2C read with exclusive access to the device.
+func (i2c *I2C) deviceRead(addr uint8, data []uint8, opt uint32) (uint32, error) {
+	i2c.device.lock()
+	defer i2c.device.mu.Unlock()
+	return _I2C_DeviceRead(i2c, addr, data, opt)
+}
+
+// finish records whether a transaction remains in progress and restores the
+// low-byte GPIO lines once a transfer ends with a stop condition or fails,
+// returning the error err of the transfer if it failed.
+func (i2c *I2C) finish(err error, stop bool) error {
+	i2c.config.active = nil == err && !stop
+	if nil == err && !stop {
+		return nil
+	}
+	if res := i2c.restoreLow(); nil == err {
+		err = res
+	}
+	return err
 }
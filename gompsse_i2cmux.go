@@ -0,0 +1,152 @@
+package gompsse
+
+import "fmt"
+
+// I2CMuxModel identifies a supported I2C multiplexer/switch part.
+type I2CMuxModel uint8
+
+// Constants defining the supported I2C multiplexer/switch parts.
+const (
+	TCA9548A I2CMuxModel = iota // 8 channels, bitmask control register
+	PCA9548A                    // 8 channels, bitmask control register
+	PCA9546A                    // 4 channels, bitmask control register
+	PCA9545A                    // 4 channels, bitmask control register
+	PCA9543A                    // 2 channels, bitmask control register
+	PCA9544A                    // 4 channels, encoded control register
+	PCA9542A                    // 2 channels, encoded control register
+)
+
+// i2cMuxModelInfo describes the control register of an I2CMuxModel.
+type i2cMuxModelInfo struct {
+	channels uint8
+	encoded  bool // channel number | enable bit (else one bit per channel)
+}
+
+var i2cMuxModels = map[I2CMuxModel]i2cMuxModelInfo{
+	TCA9548A: {channels: 8, encoded: false},
+	PCA9548A: {channels: 8, encoded: false},
+	PCA9546A: {channels: 4, encoded: false},
+	PCA9545A: {channels: 4, encoded: false},
+	PCA9543A: {channels: 2, encoded: false},
+	PCA9544A: {channels: 4, encoded: true},
+	PCA9542A: {channels: 2, encoded: true},
+}
+
+// Constants related to the I2C multiplexer control register
+const (
+	i2cMuxEncodedEnable = 0x04 // enable bit of encoded control registers
+	i2cMuxNone          = -1   // no channel selected
+	i2cMuxUnknown       = -2   // selection unknown, must be rewritten
+)
+
+// I2CMux represents an I2C multiplexer (e.g., TCA9548A) whose downstream
+// channels are each presented as a separate virtual I2C bus. The currently
+// selected channel is cached so that the control register is only written
+// when a transfer targets a different channel. When several muxes share the
+// same upstream bus, selecting a channel on one mux first deselects all
+// channels of the others, so that devices with the same address behind
+// different muxes never respond together.
+type I2CMux struct {
+	bus     *I2C
+	addr    uint8
+	model   i2cMuxModelInfo
+	current int           // selected channel, i2cMuxNone, or i2cMuxUnknown
+	segs    []*i2cSegment // downstream bus segment of each channel
+}
+
+// i2cSegment is a physical bus segment, either the bus of the MPSSE itself or
+// a downstream channel of a mux, shared by every I2C reaching that segment.
+type i2cSegment struct {
+	muxes []*I2CMux // muxes whose upstream bus is this segment
+}
+
+// i2cRoute identifies the mux channel through which a virtual I2C bus is
+// reached.
+type i2cRoute struct {
+	mux     *I2CMux
+	channel uint8
+}
+
+// Mux returns a driver for the I2C multiplexer of the given model at the given
+// 7-bit address on this bus. Muxes may be cascaded by calling Mux on a channel
+// of another mux.
+func (i2c *I2C) Mux(addr uint8, model I2CMuxModel) (*I2CMux, error) {
+	info, ok := i2cMuxModels[model]
+	if !ok {
+		return nil, fmt.Errorf("invalid I2C mux model: %d", model)
+	}
+	segs := make([]*i2cSegment, info.channels)
+	for i := range segs {
+		segs[i] = &i2cSegment{}
+	}
+	mux := &I2CMux{bus: i2c, addr: addr, model: info, current: i2cMuxUnknown,
+		segs: segs}
+	i2c.seg.muxes = append(i2c.seg.muxes, mux)
+	return mux, nil
+}
+
+func (mux *I2CMux) String() string {
+	return fmt.Sprintf("{ Addr: 0x%02X, Channels: %d, Current: %d }",
+		mux.addr, mux.model.channels, mux.current)
+}
+
+// Channel returns a virtual I2C bus for downstream channel n of the mux. Every
+// transfer on the returned bus first selects channel n, if not already
+// selected.
+func (mux *I2CMux) Channel(n uint8) (*I2C, error) {
+	if n >= mux.model.channels {
+		return nil, fmt.Errorf("invalid I2C mux channel: %d", n)
+	}
+	return &I2C{
+		device: mux.bus.device,
+		config: mux.bus.config,
+		route:  &i2cRoute{mux: mux, channel: n},
+		seg:    mux.segs[n],
+	}, nil
+}
+
+// Deselect disconnects all downstream channels from the upstream bus.
+func (mux *I2CMux) Deselect() error {
+	return mux.control(0, i2cMuxNone)
+}
+
+// Invalidate forgets the cached channel selection, forcing the control register
+// to be rewritten on the next transfer (e.g., after the mux has been reset).
+func (mux *I2CMux) Invalidate() {
+	mux.current = i2cMuxUnknown
+}
+
+// enable selects the mux channel of the receiver, if it is not already
+// selected, after deselecting every channel of any other mux on the same
+// upstream bus. A nil route refers to a physical bus and is always enabled.
+func (r *i2cRoute) enable() error {
+	if nil == r {
+		return nil
+	}
+	for _, other := range r.mux.bus.seg.muxes {
+		if other != r.mux && i2cMuxNone != other.current {
+			if err := other.Deselect(); nil != err {
+				return err
+			}
+		}
+	}
+	if int(r.channel) == r.mux.current {
+		return nil
+	}
+	ctl := uint8(1) << r.channel
+	if r.mux.model.encoded {
+		ctl = i2cMuxEncodedEnable | r.channel
+	}
+	return r.mux.control(ctl, int(r.channel))
+}
+
+// control writes ctl to the mux control register and records the resulting
+// channel selection sel.
+func (mux *I2CMux) control(ctl uint8, sel int) error {
+	if _, err := mux.bus.Write(mux.addr, []uint8{ctl}, true, true); nil != err {
+		mux.current = i2cMuxUnknown
+		return err
+	}
+	mux.current = sel
+	return nil
+}
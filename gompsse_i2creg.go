@@ -0,0 +1,201 @@
+package gompsse
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ReadReg8 reads the 8-bit register reg of the slave device at the given 7-bit
+// address, using the common "write register pointer, repeated start, read N
+// bytes" protocol.
+func (i2c *I2C) ReadReg8(addr uint8, reg uint8) (uint8, error) {
+	b := make([]uint8, 1)
+	if err := i2c.ReadRegs(addr, reg, b); nil != err {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ReadReg16 reads the big-endian 16-bit value held in registers reg and reg+1.
+func (i2c *I2C) ReadReg16(addr uint8, reg uint8) (uint16, error) {
+	b := make([]uint8, 2)
+	if err := i2c.ReadRegs(addr, reg, b); nil != err {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// ReadReg32 reads the big-endian 32-bit value held in registers reg to reg+3.
+func (i2c *I2C) ReadReg32(addr uint8, reg uint8) (uint32, error) {
+	b := make([]uint8, 4)
+	if err := i2c.ReadRegs(addr, reg, b); nil != err {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// WriteReg8 writes val to the 8-bit register reg of the slave device at the
+// given 7-bit address.
+func (i2c *I2C) WriteReg8(addr uint8, reg uint8, val uint8) error {
+	return i2c.WriteRegs(addr, reg, []uint8{val})
+}
+
+// WriteReg16 writes val big-endian to registers reg and reg+1.
+func (i2c *I2C) WriteReg16(addr uint8, reg uint8, val uint16) error {
+	b := make([]uint8, 2)
+	binary.BigEndian.PutUint16(b, val)
+	return i2c.WriteRegs(addr, reg, b)
+}
+
+// WriteReg32 writes val big-endian to registers reg to reg+3.
+func (i2c *I2C) WriteReg32(addr uint8, reg uint8, val uint32) error {
+	b := make([]uint8, 4)
+	binary.BigEndian.PutUint32(b, val)
+	return i2c.WriteRegs(addr, reg, b)
+}
+
+// ReadRegs reads len(data) consecutive bytes starting at register reg.
+func (i2c *I2C) ReadRegs(addr uint8, reg uint8, data []uint8) error {
+	return i2c.readReg(addr, []uint8{reg}, data)
+}
+
+// WriteRegs writes all bytes in data to consecutive registers starting at
+// register reg.
+func (i2c *I2C) WriteRegs(addr uint8, reg uint8, data []uint8) error {
+	return i2c.writeReg(addr, []uint8{reg}, data)
+}
+
+// readReg writes the register pointer ptr and then, after a repeated start,
+// reads len(data) bytes.
+func (i2c *I2C) readReg(addr uint8, ptr []uint8, data []uint8) error {
+	if _, err := i2c.Write(addr, ptr, true, false); nil != err {
+		return err
+	}
+	_, err := i2c.Read(addr, data, true, true)
+	return err
+}
+
+// writeReg writes the register pointer ptr followed by data.
+func (i2c *I2C) writeReg(addr uint8, ptr []uint8, data []uint8) error {
+	_, err := i2c.Write(addr, append(ptr, data...), true, true)
+	return err
+}
+
+// I2CRegMap wraps the register helpers of I2C for a single slave device whose
+// registers need more than the defaults: 16-bit register addresses, little-
+// endian values, or an auto-increment flag.
+//
+// By default, register addresses are 8-bit and multi-byte values are
+// big-endian (MSB at the lowest register address).
+type I2CRegMap struct {
+	bus       *I2C
+	addr      uint8
+	regWidth  int              // bytes per register address (1 or 2)
+	order     binary.ByteOrder // byte order of multi-byte register values
+	increment uint16           // bits set in register address for bursts
+}
+
+// RegMap returns a register map accessor for the slave device at the given
+// 7-bit address.
+func (i2c *I2C) RegMap(addr uint8) *I2CRegMap {
+	return &I2CRegMap{
+		bus:       i2c,
+		addr:      addr,
+		regWidth:  1,
+		order:     binary.BigEndian,
+		increment: 0,
+	}
+}
+
+func (r *I2CRegMap) String() string {
+	return fmt.Sprintf("{ Addr: 0x%02X, RegWidth: %d, Order: %s, Increment: 0x%X }",
+		r.addr, 8*r.regWidth, r.order, r.increment)
+}
+
+// SetRegWidth sets the width of register addresses in bits (8 or 16). 16-bit
+// register addresses are always transmitted MSB first.
+func (r *I2CRegMap) SetRegWidth(bits int) error {
+	switch bits {
+	case 8, 16:
+		r.regWidth = bits / 8
+		return nil
+	default:
+		return fmt.Errorf("invalid register address width: %d", bits)
+	}
+}
+
+// SetByteOrder sets the byte order of multi-byte register values.
+func (r *I2CRegMap) SetByteOrder(order binary.ByteOrder) {
+	r.order = order
+}
+
+// SetAutoIncrement sets the bits OR'd into the register address of every
+// multi-byte access, for devices that only auto-increment the register pointer
+// when requested (e.g., bit 7 of the sub-address on many ST sensors). Use 0 to
+// disable.
+func (r *I2CRegMap) SetAutoIncrement(bits uint16) {
+	r.increment = bits
+}
+
+func (r *I2CRegMap) ReadReg8(reg uint16) (uint8, error) {
+	b := make([]uint8, 1)
+	if err := r.ReadBlock(reg, b); nil != err {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *I2CRegMap) ReadReg16(reg uint16) (uint16, error) {
+	b := make([]uint8, 2)
+	if err := r.ReadBlock(reg, b); nil != err {
+		return 0, err
+	}
+	return r.order.Uint16(b), nil
+}
+
+func (r *I2CRegMap) ReadReg32(reg uint16) (uint32, error) {
+	b := make([]uint8, 4)
+	if err := r.ReadBlock(reg, b); nil != err {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+func (r *I2CRegMap) WriteReg8(reg uint16, val uint8) error {
+	return r.WriteBlock(reg, []uint8{val})
+}
+
+func (r *I2CRegMap) WriteReg16(reg uint16, val uint16) error {
+	b := make([]uint8, 2)
+	r.order.PutUint16(b, val)
+	return r.WriteBlock(reg, b)
+}
+
+func (r *I2CRegMap) WriteReg32(reg uint16, val uint32) error {
+	b := make([]uint8, 4)
+	r.order.PutUint32(b, val)
+	return r.WriteBlock(reg, b)
+}
+
+// ReadBlock reads len(data) consecutive bytes starting at register reg.
+func (r *I2CRegMap) ReadBlock(reg uint16, data []uint8) error {
+	return r.bus.readReg(r.addr, r.pointer(reg, len(data)), data)
+}
+
+// WriteBlock writes all bytes in data to consecutive registers starting at
+// register reg.
+func (r *I2CRegMap) WriteBlock(reg uint16, data []uint8) error {
+	return r.bus.writeReg(r.addr, r.pointer(reg, len(data)), data)
+}
+
+// pointer returns the register address bytes used to access n bytes starting
+// at register reg.
+func (r *I2CRegMap) pointer(reg uint16, n int) []uint8 {
+	if n > 1 {
+		reg |= r.increment
+	}
+	if 1 == r.regWidth {
+		return []uint8{uint8(reg)}
+	}
+	return []uint8{uint8(reg >> 8), uint8(reg)}
+}
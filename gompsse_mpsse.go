@@ -0,0 +1,399 @@
+package gompsse
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Constants defining the opcodes understood by the MPSSE command processor,
+// as documented in FTDI application note AN_108. These are used whenever an
+// operation is not (or cannot be) provided by libMPSSE itself.
+const (
+	mpsseSetLowByte      = 0x80 // set value and direction of low-byte lines
+	mpsseGetLowByte      = 0x81 // read value of low-byte lines
+	mpsseSetHighByte     = 0x82 // set value and direction of high-byte lines
+	mpsseGetHighByte     = 0x83 // read value of high-byte lines
+	mpsseLoopbackOn      = 0x84 // connect TDI/DO to TDO/DI
+	mpsseLoopbackOff     = 0x85 // disconnect TDI/DO from TDO/DI
+	mpsseSetClockDivisor = 0x86 // set TCK/SK divisor (2 operand bytes)
+	mpsseSendImmediate   = 0x87 // flush device buffer back to host
+	mpsseWaitIOHigh      = 0x88 // wait until GPIOL1 (JTAG) is high
+	mpsseWaitIOLow       = 0x89 // wait until GPIOL1 (JTAG) is low
+	mpsseClockDivide5Off = 0x8A // use 60 MHz master clock
+	mpsseClockDivide5On  = 0x8B // use 12 MHz master clock (divide-by-5)
+	mpsse3PhaseOn        = 0x8C // enable 3-phase data clocking
+	mpsse3PhaseOff       = 0x8D // disable 3-phase data clocking
+	mpsseClockBits       = 0x8E // clock n+1 bits without data transfer
+	mpsseClockBytes      = 0x8F // clock (n+1)*8 bits without data transfer
+	mpsseAdaptiveOn      = 0x96 // enable adaptive clocking
+	mpsseAdaptiveOff     = 0x97 // disable adaptive clocking
+	mpsseDriveOnlyZero   = 0x9E // set low/high-byte lines to open-drain
+
+	// Bit flags combined to form the data shifting opcodes (0x10-0x3F)
+	mpsseDataOutNeg   = 0x01 // write on falling edge (else rising edge)
+	mpsseDataBits     = 0x02 // length is in bits (else bytes)
+	mpsseDataInNeg    = 0x04 // read on falling edge (else rising edge)
+	mpsseDataLSBFirst = 0x08 // shift LSB first (else MSB first)
+	mpsseDataOut      = 0x10 // write data on TDI/DO
+	mpsseDataIn       = 0x20 // read data from TDO/DI
+
+	// Response returned by the command processor for an unrecognized opcode,
+	// which is followed by the opcode itself, and an opcode it never accepts
+	mpsseBadCommand = 0xFA
+	mpsseBadOpcode  = 0xAA
+)
+
+// Constants defining the FTDI bit modes used to reset the MPSSE.
+const (
+	bitModeReset = 0x00 // reset I/O bit mode (disables MPSSE)
+	bitModeMPSSE = 0x02 // enable MPSSE
+)
+
+// Constants related to the timing of commands waiting on external events.
+const (
+	mpssePollInterval = time.Millisecond // receive queue polling interval
+)
+
+// ErrTimeout is returned when the device does not respond within the time
+// allowed by an operation waiting on an external event.
+var ErrTimeout = errors.New("timeout")
+
+// Constants related to the capacity of the MPSSE command processor.
+const (
+	mpsseMaxXferBytes = 0x10000 // max length of a single byte shifting opcode
+
+	// mpsseSetByteTime is the time assumed for the command processor to execute
+	// one 3-byte set-byte command, used to generate delays in the command
+	// stream by repeating that command. It is not documented by FTDI, nor
+	// measured here: it is derived from the command processor reading at most
+	// one byte per cycle of the 60 MHz master clock, which makes it a lower
+	// bound. Delays are therefore never shorter than requested, but may be
+	// several times longer, depending on the device and on how quickly the
+	// USB transfer delivers the commands.
+	mpsseSetByteTime = 50 * time.Nanosecond
+
+	// mpsseMaxDelay is the longest delay generated with set-byte commands,
+	// which at 3 bytes per mpsseSetByteTime already needs a 60 KiB command
+	// buffer. Longer delays must be made by the host between transfers.
+	mpsseMaxDelay = time.Millisecond
+)
+
+// mpsseCmd accumulates MPSSE opcodes and operands so that an entire sequence
+// can be delivered to the device in a single USB transfer. it also tracks the
+// number of bytes the sequence will return to the host.
+type mpsseCmd struct {
+	buf []uint8
+	rx  int
+}
+
+// append adds raw opcode and operand bytes to the command sequence.
+func (c *mpsseCmd) append(b ...uint8) *mpsseCmd {
+	c.buf = append(c.buf, b...)
+	return c
+}
+
+// setLow sets the value and direction of the MPSSE low-byte lines. the command
+// is repeated n times, which is the conventional way to hold a pin state for a
+// deterministic duration from within the command stream.
+func (c *mpsseCmd) setLow(val uint8, dir uint8, n int) *mpsseCmd {
+	for i := 0; i < n; i++ {
+		c.append(mpsseSetLowByte, val, dir)
+	}
+	return c
+}
+
+// delayValid returns an error if d cannot be generated by delay.
+func delayValid(d time.Duration) error {
+	if d < 0 || d > mpsseMaxDelay {
+		return fmt.Errorf("invalid delay: %s (max %s)", d, mpsseMaxDelay)
+	}
+	return nil
+}
+
+// delay holds the low-byte lines at the given value and direction for at least
+// duration d by repeating the set-byte command, which (unlike clock-only
+// commands) produces no activity on SCLK. d must have been checked with
+// delayValid, so that the command buffer remains bounded.
+func (c *mpsseCmd) delay(val uint8, dir uint8, d time.Duration) *mpsseCmd {
+	return c.setLow(val, dir, delayCount(d))
+}
+
+// delayCount returns the number of set-byte commands appended by delay for
+// duration d, each of which is 3 bytes.
+func delayCount(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + mpsseSetByteTime - 1) / mpsseSetByteTime)
+}
+
+// setHigh sets the value and direction of the MPSSE high-byte lines.
+func (c *mpsseCmd) setHigh(val uint8, dir uint8) *mpsseCmd {
+	return c.append(mpsseSetHighByte, val, dir)
+}
+
+// setClock sets the SCLK divisor and, on Hi-Speed devices, enables or disables
+// the divide-by-5 prescaler of the 60 MHz master clock. the resulting SCLK rate
+// is (60 MHz or 12 MHz) / ((1 + div) * 2).
+func (c *mpsseCmd) setClock(div5 bool, div uint16, hiSpeed bool) *mpsseCmd {
+	if hiSpeed {
+		if div5 {
+			c.append(mpsseClockDivide5On)
+		} else {
+			c.append(mpsseClockDivide5Off)
+		}
+	}
+	return c.append(mpsseSetClockDivisor, uint8(div), uint8(div>>8))
+}
+
+// clockOnly clocks SCLK/TCK for n cycles without transferring any data, using
+// as few commands as possible.
+func (c *mpsseCmd) clockOnly(n int) *mpsseCmd {
+	for n >= 8 {
+		size := n / 8
+		if size > mpsseMaxXferBytes {
+			size = mpsseMaxXferBytes
+		}
+		c.append(mpsseClockBytes, uint8(size-1), uint8((size-1)>>8))
+		n -= 8 * size
+	}
+	if n > 0 {
+		c.append(mpsseClockBits, uint8(n-1))
+	}
+	return c
+}
+
+// getLow samples the MPSSE low-byte lines, returning 1 byte to the host.
+func (c *mpsseCmd) getLow() *mpsseCmd {
+	c.rx++
+	return c.append(mpsseGetLowByte)
+}
+
+// getHigh samples the MPSSE high-byte lines, returning 1 byte to the host.
+func (c *mpsseCmd) getHigh() *mpsseCmd {
+	c.rx++
+	return c.append(mpsseGetHighByte)
+}
+
+// shiftBytes appends the data shifting opcode op for n bytes, followed by the
+// bytes of out if op writes data. transfers longer than the command processor
+// accepts in a single opcode are split into multiple opcodes.
+func (c *mpsseCmd) shiftBytes(op uint8, out []uint8, n int) *mpsseCmd {
+	for pos := 0; pos < n; pos += mpsseMaxXferBytes {
+		size := n - pos
+		if size > mpsseMaxXferBytes {
+			size = mpsseMaxXferBytes
+		}
+		c.append(op, uint8(size-1), uint8((size-1)>>8))
+		if 0 != op&mpsseDataOut {
+			c.append(out[pos : pos+size]...)
+		}
+		if 0 != op&mpsseDataIn {
+			c.rx += size
+		}
+	}
+	return c
+}
+
+// shiftBits appends the bit shifting variant of data shifting opcode op for n
+// (1-8) bits of out (if op writes data), taken from its most significant end,
+// or from its least significant end if op shifts LSB first.
+func (c *mpsseCmd) shiftBits(op uint8, out uint8, n int) *mpsseCmd {
+	op |= mpsseDataBits
+	c.append(op, uint8(n-1))
+	if 0 != op&mpsseDataOut {
+		c.append(out)
+	}
+	if 0 != op&mpsseDataIn {
+		c.rx++
+	}
+	return c
+}
+
+// flush instructs the device to return any pending bytes immediately rather
+// than waiting for its latency timer to expire.
+func (c *mpsseCmd) flush() *mpsseCmd {
+	return c.append(mpsseSendImmediate)
+}
+
+// exec sends the command sequence cmd to the device and, if the sequence
+// produces any output, reads back and returns all of it. The MPSSE is enabled
+// first if no serial mode is active.
+func (m *MPSSE) exec(cmd *mpsseCmd) ([]uint8, error) {
+
+	if cmd.rx > 0 {
+		cmd.flush()
+	}
+
+	m.lock()
+	defer m.mu.Unlock()
+
+	if err := m.enable(); nil != err {
+		return nil, err
+	}
+	if err := m.send(cmd); nil != err {
+		return nil, err
+	}
+
+	return m.recv(cmd.rx)
+}
+
+// lock acquires exclusive access to the device once any queued SPI transfers
+// have been written and all of their output has been read back, so that it
+// cannot be mistaken for the output of other commands. No transfer can be
+// submitted until m.mu is released.
+func (m *MPSSE) lock() {
+	m.mu.Lock()
+	m.SPI.drain()
+}
+
+// send writes the command sequence cmd to the device.
+func (m *MPSSE) send(cmd *mpsseCmd) error {
+	if sent, err := _FT_Write(m, cmd.buf); nil != err {
+		return err
+	} else if int(sent) != len(cmd.buf) {
+		return fmt.Errorf("short write: %d of %d bytes", sent, len(cmd.buf))
+	}
+	return nil
+}
+
+// recv reads n bytes of command output from the device.
+func (m *MPSSE) recv(n int) ([]uint8, error) {
+
+	if 0 == n {
+		return nil, nil
+	}
+
+	buf := make([]uint8, n)
+	for got := 0; got < len(buf); {
+		n, err := _FT_Read(m, buf[got:])
+		if nil != err {
+			return buf[:got], err
+		}
+		if 0 == n {
+			return buf[:got], fmt.Errorf("short read: %d of %d bytes", got, len(buf))
+		}
+		got += int(n)
+	}
+
+	return buf, nil
+}
+
+// execTimeout sends the command sequence cmd to the device like exec, but waits
+// at most timeout for its output to be returned. cmd should wait on an external
+// event and must produce output. On timeout, the blocked command processor is
+// aborted and ErrTimeout is returned. The device remains locked until it has
+// been aborted and restored, so that no other goroutine can send commands to a
+// command processor that is still blocked.
+func (m *MPSSE) execTimeout(cmd *mpsseCmd, timeout time.Duration) ([]uint8, error) {
+
+	cmd.flush()
+
+	m.lock()
+	defer m.mu.Unlock()
+
+	if err := m.enable(); nil != err {
+		return nil, err
+	}
+	if err := m.send(cmd); nil != err {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		n, err := _FT_GetQueueStatus(m)
+		if nil != err {
+			return nil, err
+		}
+		if int(n) >= cmd.rx {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err := m.abort(); nil != err {
+				return nil, err
+			}
+			return nil, ErrTimeout
+		}
+		time.Sleep(mpssePollInterval)
+	}
+
+	return m.recv(cmd.rx)
+}
+
+// abort cancels any commands pending in the device, including one blocked
+// waiting on an external event, by purging the USB buffers and resetting the
+// MPSSE, and then restores the state of the active mode. The caller must hold
+// m.mu.
+func (m *MPSSE) abort() error {
+
+	if err := m.reset(); nil != err {
+		return err
+	}
+
+	switch m.mode {
+	case ModeI2C:
+		return m.I2C.init()
+	case ModeSPI:
+		return m.SPI.restore()
+	default:
+		cmd := &mpsseCmd{}
+		cmd.setLow(m.low.val&m.low.dir, m.low.dir, 1)
+		cmd.setHigh(m.GPIO.config.val&m.GPIO.config.dir, m.GPIO.config.dir)
+		return m.send(cmd)
+	}
+}
+
+// enable prepares the MPSSE for raw commands when no serial mode, whose
+// libMPSSE channel initialization would otherwise do so, is active: it enables
+// MPSSE bit mode, synchronizes with the command processor by checking its
+// response to a bad opcode, selects the 60 MHz master clock with the fastest
+// divisor, and rewrites the GPIO lines. Nothing is done once enabled. The
+// caller must hold m.mu.
+func (m *MPSSE) enable() error {
+
+	if m.raw || ModeNone != m.mode {
+		return nil
+	}
+
+	if err := m.reset(); nil != err {
+		return err
+	}
+
+	probe := &mpsseCmd{}
+	probe.append(mpsseBadOpcode).flush()
+	if err := m.send(probe); nil != err {
+		return err
+	}
+	if in, err := m.recv(2); nil != err {
+		return err
+	} else if mpsseBadCommand != in[0] || mpsseBadOpcode != in[1] {
+		return fmt.Errorf("MPSSE not synchronized: % X", in)
+	}
+
+	cmd := &mpsseCmd{}
+	cmd.setClock(false, 0, m.info.isHiSpeedMPSSE())
+	cmd.append(mpsseLoopbackOff)
+	cmd.setLow(m.low.val&m.low.dir, m.low.dir, 1)
+	cmd.setHigh(m.GPIO.config.val&m.GPIO.config.dir, m.GPIO.config.dir)
+	if err := m.send(cmd); nil != err {
+		return err
+	}
+
+	m.raw = true
+	return nil
+}
+
+// reset purges the USB buffers and resets the MPSSE. The caller must hold m.mu.
+func (m *MPSSE) reset() error {
+	if err := _FT_Purge(m); nil != err {
+		return err
+	}
+	if err := _FT_SetBitMode(m, 0, bitModeReset); nil != err {
+		return err
+	}
+	if err := _FT_SetBitMode(m, 0, bitModeMPSSE); nil != err {
+		return err
+	}
+	return _FT_Purge(m)
+}
@@ -0,0 +1,73 @@
+package gompsse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pin is a single GPIO line. It is implemented for the MPSSE high-byte and
+// low-byte lines by the values returned from MPSSE.Pin, and may be implemented
+// by other types (e.g., I/O expander drivers) so that driver code can use any
+// GPIO line without knowing where it lives.
+type Pin interface {
+	Name() string         // name of the pin, e.g., "C3"
+	Number() int          // unique number of the pin on its device
+	In() error            // configure as input
+	Out(level bool) error // configure as output driving level
+	Read() (bool, error)  // sample current level
+}
+
+// Pin returns the MPSSE GPIO line with the given name: "D0"-"D7" for the
+// low-byte lines (numbered 0-7) or "C0"-"C7" for the high-byte lines (numbered
+// 8-15), case-insensitive. Low-byte lines in use by SPI or I2C cannot be
+// accessed as GPIO.
+func (m *MPSSE) Pin(name string) (Pin, error) {
+
+	s := strings.ToUpper(strings.TrimSpace(name))
+	if 2 != len(s) {
+		return nil, fmt.Errorf("invalid pin name: %q", name)
+	}
+
+	n, err := strconv.Atoi(s[1:])
+	if nil != err || n < 0 || n >= NumDPins {
+		return nil, fmt.Errorf("invalid pin name: %q", name)
+	}
+
+	switch s[0] {
+	case 'D':
+		return &dPin{gpio: m.GPIO, pin: DPin(1 << uint(n)), num: n}, nil
+	case 'C':
+		return &cPin{gpio: m.GPIO, pin: CPin(1 << uint(n)), num: NumDPins + n}, nil
+	default:
+		return nil, fmt.Errorf("invalid pin name: %q", name)
+	}
+}
+
+// cPin is a Pin on the MPSSE high-byte lines.
+type cPin struct {
+	gpio *GPIO
+	pin  CPin
+	num  int
+}
+
+func (p *cPin) Name() string         { return fmt.Sprintf("C%d", p.num-NumDPins) }
+func (p *cPin) Number() int          { return p.num }
+func (p *cPin) In() error            { return p.gpio.SetDirection(p.pin, false) }
+func (p *cPin) Out(level bool) error { return p.gpio.drive(p.pin, level) }
+func (p *cPin) Read() (bool, error)  { return p.gpio.Input(p.pin) }
+func (p *cPin) String() string       { return p.Name() }
+
+// dPin is a Pin on the MPSSE low-byte lines.
+type dPin struct {
+	gpio *GPIO
+	pin  DPin
+	num  int
+}
+
+func (p *dPin) Name() string         { return fmt.Sprintf("D%d", p.num) }
+func (p *dPin) Number() int          { return p.num }
+func (p *dPin) In() error            { return p.gpio.SetDirectionD(p.pin, false) }
+func (p *dPin) Out(level bool) error { return p.gpio.driveD(p.pin, level) }
+func (p *dPin) Read() (bool, error)  { return p.gpio.InputD(p.pin) }
+func (p *dPin) String() string       { return p.Name() }
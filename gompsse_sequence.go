@@ -0,0 +1,225 @@
+package gompsse
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Sequence is a list of GPIO pin states and delays, such as a bit-banged
+// protocol, a reset sequence, or a train of stepper pulses, which is compiled
+// into a single MPSSE command buffer and executed atomically by Run with one
+// USB transfer, rather than one per edge.
+//
+// Each step records only the pins it writes, and is applied to the state the
+// lines have when Run is called, so that pins changed between building and
+// running the sequence keep their new state.
+//
+// The methods adding steps return the Sequence so that calls can be chained.
+// Any error encountered while adding steps is returned by Run.
+type Sequence struct {
+	gpio  *GPIO
+	step  []seqStep
+	low   uint8   // low-byte lines written by any step
+	clock float64 // SCLK/TCK rate for clock-only delays, 0 if not used
+	err   error
+}
+
+// seqStep is a single step of a Sequence: a write to the lines in the masks of
+// either byte of lines, a delay, or a change of the MPSSE clock.
+type seqStep struct {
+	high    bool          // write the high-byte lines, else the low-byte
+	dirMask uint8         // lines whose direction is written
+	dir     uint8         // direction of the lines in dirMask
+	valMask uint8         // lines whose output latch is written
+	val     uint8         // output latch of the lines in valMask
+	delay   time.Duration // set-byte delay, if positive
+	cycles  int           // clock-only delay, if positive
+	clk     *spiClock     // MPSSE clock setting, if not nil
+}
+
+// apply updates cfg with the write performed by the step.
+func (st *seqStep) apply(cfg *gpioConfig) {
+	cfg.set(st.dirMask, st.dir, st.valMask, st.val)
+}
+
+// Sequence returns a new, empty Sequence.
+func (gpio *GPIO) Sequence() *Sequence {
+	return &Sequence{gpio: gpio}
+}
+
+// Write sets the direction and output latch of all high-byte lines.
+func (s *Sequence) Write(dir uint8, val uint8) *Sequence {
+	s.step = append(s.step, seqStep{high: true,
+		dirMask: 0xFF, dir: dir, valMask: 0xFF, val: val})
+	return s
+}
+
+// Set drives the given high-byte pin(s) as outputs with the given level.
+func (s *Sequence) Set(pin CPin, level bool) *Sequence {
+	var val uint8
+	if level {
+		val = uint8(pin)
+	}
+	s.step = append(s.step, seqStep{high: true,
+		dirMask: uint8(pin), dir: uint8(pin), valMask: uint8(pin), val: val})
+	return s
+}
+
+// WriteD sets the direction and output latch of the low-byte lines in mask,
+// which must not be in use by SPI or I2C.
+func (s *Sequence) WriteD(mask DPin, dir uint8, val uint8) *Sequence {
+	if res := s.gpio.device.reservedLow() & uint8(mask); 0 != res {
+		s.fail(fmt.Errorf("pins in use by %s: 0x%02X", s.gpio.device.mode, res))
+		return s
+	}
+	s.low |= uint8(mask)
+	s.step = append(s.step, seqStep{
+		dirMask: uint8(mask), dir: dir, valMask: uint8(mask), val: val})
+	return s
+}
+
+// SetD drives the given low-byte pin(s) as outputs with the given level.
+func (s *Sequence) SetD(pin DPin, level bool) *Sequence {
+	var val uint8
+	if level {
+		val = uint8(pin)
+	}
+	return s.WriteD(pin, uint8(pin), val)
+}
+
+// Out drives the given MPSSE pin (as returned by MPSSE.Pin) as an output with
+// the given level.
+func (s *Sequence) Out(pin Pin, level bool) *Sequence {
+	switch p := pin.(type) {
+	case *cPin:
+		return s.Set(p.pin, level)
+	case *dPin:
+		return s.SetD(p.pin, level)
+	default:
+		s.fail(fmt.Errorf("pin not on MPSSE: %s", pin.Name()))
+		return s
+	}
+}
+
+// Delay holds all pins in their current state for at least duration d. Without
+// ClockDelays, d is at most 1 ms and may be exceeded by several times.
+func (s *Sequence) Delay(d time.Duration) *Sequence {
+	if s.clock > 0 {
+		if d < 0 {
+			s.fail(fmt.Errorf("invalid delay: %s", d))
+			return s
+		}
+		if 0 == d {
+			return s
+		}
+		s.step = append(s.step, seqStep{cycles: int(math.Ceil(d.Seconds() * s.clock))})
+		return s
+	}
+	if err := delayValid(d); nil != err {
+		s.fail(err)
+		return s
+	}
+	if 0 == d {
+		return s
+	}
+	s.step = append(s.step, seqStep{delay: d})
+	return s
+}
+
+// ClockDelays makes all subsequent delays use clock-only commands at the given
+// TCK rate (D0), which are timed exactly by the MPSSE clock rather than by the
+// execution time of repeated set-byte commands. D0 must not be connected to
+// anything that responds to a clock. Only possible when no serial mode is
+// active and no waveform is being generated.
+func (s *Sequence) ClockDelays(hz uint32) *Sequence {
+	if ModeNone != s.gpio.device.mode {
+		s.fail(fmt.Errorf("clock-only delays not possible in %s mode", s.gpio.device.mode))
+		return s
+	}
+	if 0 == hz || hz > spiClockMaximum {
+		s.fail(fmt.Errorf("invalid clock rate: %d", hz))
+		return s
+	}
+	clk, err := spiClockDivisor(s.gpio.device.info, hz, ClockNearest)
+	if nil != err {
+		s.fail(err)
+		return s
+	}
+	s.step = append(s.step, seqStep{clk: &clk})
+	s.clock = clk.rate
+	return s
+}
+
+// Len returns the size in bytes of the compiled command buffer.
+func (s *Sequence) Len() int {
+	low, high := gpioConfig{}, gpioConfig{}
+	return len(s.compile(&low, &high).buf)
+}
+
+// Run executes the sequence, applying its steps to the current state of the
+// lines. It may be run any number of times.
+func (s *Sequence) Run() error {
+
+	if nil != s.err {
+		return s.err
+	}
+
+	m := s.gpio.device
+	m.lock()
+	defer m.mu.Unlock()
+
+	if res := m.reservedLow() & s.low; 0 != res {
+		return fmt.Errorf("pins in use by %s: 0x%02X", m.mode, res)
+	}
+	if s.clock > 0 && ModeNone != m.mode {
+		return fmt.Errorf("clock-only delays not possible in %s mode", m.mode)
+	}
+	if s.clock > 0 && nil != m.gen {
+		return fmt.Errorf("clock-only delays not possible while generating a waveform")
+	}
+	if err := m.enable(); nil != err {
+		return err
+	}
+
+	low, high := *m.low, *s.gpio.config
+	if err := m.send(s.compile(&low, &high)); nil != err { // produces no output
+		return err
+	}
+
+	*m.low = low
+	*s.gpio.config = high
+
+	return nil
+}
+
+// compile returns the commands performing the sequence, starting from the line
+// states low and high, which are updated with the states once it is executed.
+func (s *Sequence) compile(low *gpioConfig, high *gpioConfig) *mpsseCmd {
+	cmd := &mpsseCmd{}
+	for i := range s.step {
+		st := &s.step[i]
+		switch {
+		case nil != st.clk:
+			cmd.setClock(st.clk.div5, st.clk.div, s.gpio.device.info.isHiSpeedMPSSE())
+		case st.cycles > 0:
+			cmd.clockOnly(st.cycles)
+		case st.delay > 0:
+			cmd.delay(low.val&low.dir, low.dir, st.delay)
+		case st.high:
+			st.apply(high)
+			cmd.setHigh(high.val&high.dir, high.dir)
+		default:
+			st.apply(low)
+			cmd.setLow(low.val&low.dir, low.dir, 1)
+		}
+	}
+	return cmd
+}
+
+// fail records the first error encountered while adding steps.
+func (s *Sequence) fail(err error) {
+	if nil == s.err {
+		s.err = err
+	}
+}
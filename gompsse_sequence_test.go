@@ -0,0 +1,29 @@
+package gompsse
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSequenceCompile(t *testing.T) {
+
+	gpio := &GPIO{device: &MPSSE{low: &gpioConfig{}}, config: &gpioConfig{}}
+	seq := gpio.Sequence().SetD(D1, true).Set(C2, false).SetD(D1, false)
+
+	// lines not written by the sequence keep the state they have when run
+	low := gpioConfig{dir: 0x10, val: 0x10}
+	high := gpioConfig{dir: 0x01, val: 0x01}
+	cmd := seq.compile(&low, &high)
+
+	want := []uint8{
+		mpsseSetLowByte, 0x12, 0x12,
+		mpsseSetHighByte, 0x01, 0x05,
+		mpsseSetLowByte, 0x10, 0x12,
+	}
+	if !bytes.Equal(cmd.buf, want) {
+		t.Errorf("got % X, want % X", cmd.buf, want)
+	}
+	if (gpioConfig{dir: 0x12, val: 0x10}) != low || (gpioConfig{dir: 0x05, val: 0x01}) != high {
+		t.Errorf("got low %+v high %+v", low, high)
+	}
+}
@@ -0,0 +1,234 @@
+package gompsse
+
+import "fmt"
+
+// Constants related to the SMBus protocol
+const (
+	smbusBlockMax = 32   // max number of data bytes in a block transfer
+	smbusPECPoly  = 0x07 // CRC-8 polynomial x^8 + x^2 + x + 1
+)
+
+// PECError is returned when the Packet Error Code received from an SMBus device
+// does not match the one calculated over the rest of the received message.
+type PECError struct {
+	Addr uint8 // 7-bit slave address
+	Cmd  uint8 // command code of the failed transaction
+	Want uint8 // PEC calculated by the host
+	Got  uint8 // PEC received from the slave
+}
+
+func (e *PECError) Error() string {
+	return fmt.Sprintf("SMBus PEC mismatch (addr 0x%02X, cmd 0x%02X): "+
+		"calculated 0x%02X, received 0x%02X", e.Addr, e.Cmd, e.Want, e.Got)
+}
+
+// smbusPEC updates the CRC-8 Packet Error Code crc with each byte in data.
+func smbusPEC(crc uint8, data ...uint8) uint8 {
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if 0 != crc&0x80 {
+				crc = (crc << 1) ^ smbusPECPoly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// SMBus implements the SMBus 2.0 command protocols for a single slave device
+// on an I2C bus, optionally with Packet Error Checking (PEC). All multi-byte
+// words are transferred least-significant byte first per the SMBus spec.
+type SMBus struct {
+	bus  *I2C
+	addr uint8
+	pec  bool
+}
+
+// SMBus returns an SMBus protocol handler for the slave device at the given
+// 7-bit address, with PEC generation and verification enabled if pec is true.
+func (i2c *I2C) SMBus(addr uint8, pec bool) *SMBus {
+	return &SMBus{bus: i2c, addr: addr, pec: pec}
+}
+
+func (s *SMBus) String() string {
+	return fmt.Sprintf("{ Addr: 0x%02X, PEC: %t }", s.addr, s.pec)
+}
+
+// SetPEC enables or disables Packet Error Checking on all subsequent commands.
+func (s *SMBus) SetPEC(enable bool) {
+	s.pec = enable
+}
+
+// Quick sends only the slave address with the R/W bit set according to read.
+// PEC is never used with Quick.
+func (s *SMBus) Quick(read bool) error {
+	if read {
+		_, err := s.bus.Read(s.addr, nil, true, true)
+		return err
+	}
+	_, err := s.bus.Write(s.addr, nil, true, true)
+	return err
+}
+
+func (s *SMBus) SendByte(val uint8) error {
+	return s.write(val)
+}
+
+func (s *SMBus) ReceiveByte() (uint8, error) {
+	b, err := s.read(nil, 1)
+	if nil != err {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (s *SMBus) WriteByteData(cmd uint8, val uint8) error {
+	return s.write(cmd, val)
+}
+
+func (s *SMBus) ReadByteData(cmd uint8) (uint8, error) {
+	b, err := s.read([]uint8{cmd}, 1)
+	if nil != err {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (s *SMBus) WriteWordData(cmd uint8, val uint16) error {
+	return s.write(cmd, uint8(val), uint8(val>>8))
+}
+
+func (s *SMBus) ReadWordData(cmd uint8) (uint16, error) {
+	b, err := s.read([]uint8{cmd}, 2)
+	if nil != err {
+		return 0, err
+	}
+	return uint16(b[0]) | uint16(b[1])<<8, nil
+}
+
+func (s *SMBus) WriteBlockData(cmd uint8, data []uint8) error {
+	if 0 == len(data) || len(data) > smbusBlockMax {
+		return fmt.Errorf("invalid SMBus block length: %d", len(data))
+	}
+	return s.write(append([]uint8{cmd, uint8(len(data))}, data...)...)
+}
+
+func (s *SMBus) ReadBlockData(cmd uint8) ([]uint8, error) {
+	return s.readBlock([]uint8{cmd})
+}
+
+// ProcessCall writes a word to the given command and reads back the word the
+// slave computed in response, using a repeated start between the two.
+func (s *SMBus) ProcessCall(cmd uint8, val uint16) (uint16, error) {
+	b, err := s.read([]uint8{cmd, uint8(val), uint8(val >> 8)}, 2)
+	if nil != err {
+		return 0, err
+	}
+	return uint16(b[0]) | uint16(b[1])<<8, nil
+}
+
+// BlockProcessCall writes a block of data to the given command and reads back
+// the block the slave computed in response, using a repeated start between the
+// two.
+func (s *SMBus) BlockProcessCall(cmd uint8, data []uint8) ([]uint8, error) {
+	if 0 == len(data) || len(data) > smbusBlockMax {
+		return nil, fmt.Errorf("invalid SMBus block length: %d", len(data))
+	}
+	return s.readBlock(append([]uint8{cmd, uint8(len(data))}, data...))
+}
+
+// write sends the given bytes to the slave in a single write transaction,
+// appending the PEC if enabled.
+func (s *SMBus) write(data ...uint8) error {
+	if s.pec {
+		data = append(data, smbusPEC(0, append([]uint8{s.addr << 1}, data...)...))
+	}
+	_, err := s.bus.Write(s.addr, data, true, true)
+	return err
+}
+
+// read sends the bytes in wr to the slave (if any) followed by a repeated start
+// and reads n bytes from the slave, verifying the trailing PEC if enabled.
+func (s *SMBus) read(wr []uint8, n int) ([]uint8, error) {
+
+	crc := uint8(0)
+	if len(wr) > 0 {
+		if _, err := s.bus.Write(s.addr, wr, true, false); nil != err {
+			return nil, err
+		}
+		crc = smbusPEC(crc, append([]uint8{s.addr << 1}, wr...)...)
+	}
+
+	rd := make([]uint8, n)
+	if s.pec {
+		rd = append(rd, 0)
+	}
+	if _, err := s.bus.Read(s.addr, rd, true, true); nil != err {
+		return nil, err
+	}
+
+	if s.pec {
+		crc = smbusPEC(crc, append([]uint8{s.addr<<1 | 1}, rd[:n]...)...)
+		if err := s.verify(wr, crc, rd[n]); nil != err {
+			return nil, err
+		}
+	}
+
+	return rd[:n], nil
+}
+
+// readBlock sends the bytes in wr to the slave followed by a repeated start and
+// reads a block from the slave whose length is given by the first byte read,
+// verifying the trailing PEC if enabled.
+func (s *SMBus) readBlock(wr []uint8) ([]uint8, error) {
+
+	if _, err := s.bus.Write(s.addr, wr, true, false); nil != err {
+		return nil, err
+	}
+
+	count := []uint8{0}
+	if _, err := s.bus.Read(s.addr, count, true, false); nil != err {
+		return nil, err
+	}
+
+	n := int(count[0])
+	if 0 == n || n > smbusBlockMax {
+		// the slave is still expecting an ACK/NACK, so end the transfer cleanly
+		_, _ = s.bus.readFinal([]uint8{0})
+		return nil, fmt.Errorf("invalid SMBus block length: %d", n)
+	}
+
+	rd := make([]uint8, n)
+	if s.pec {
+		rd = append(rd, 0)
+	}
+	if _, err := s.bus.readFinal(rd); nil != err {
+		return nil, err
+	}
+
+	if s.pec {
+		crc := smbusPEC(0, append([]uint8{s.addr << 1}, wr...)...)
+		crc = smbusPEC(crc, s.addr<<1|1, count[0])
+		crc = smbusPEC(crc, rd[:n]...)
+		if err := s.verify(wr, crc, rd[n]); nil != err {
+			return nil, err
+		}
+	}
+
+	return rd[:n], nil
+}
+
+// verify returns a PECError if the PEC received from the slave does not match
+// the PEC calculated by the host.
+func (s *SMBus) verify(wr []uint8, want uint8, got uint8) error {
+	if want == got {
+		return nil
+	}
+	e := &PECError{Addr: s.addr, Want: want, Got: got}
+	if len(wr) > 0 {
+		e.Cmd = wr[0]
+	}
+	return e
+}
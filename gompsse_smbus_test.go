@@ -0,0 +1,26 @@
+package gompsse
+
+import "testing"
+
+func TestSMBusPEC(t *testing.T) {
+
+	tests := []struct {
+		name string
+		crc  uint8
+		data []uint8
+		want uint8
+	}{
+		{"empty", 0x00, nil, 0x00},
+		{"empty seeded", 0x5A, nil, 0x5A},
+		{"single", 0x00, []uint8{0x01}, 0x07},
+		{"check value", 0x00, []uint8("123456789"), 0xF4},
+		// write byte 0x55 to command 0x10 of device 0x5A, computed in two steps
+		{"incremental", 0x00, []uint8{0xB4, 0x10, 0x55}, smbusPEC(smbusPEC(0x00, 0xB4), 0x10, 0x55)},
+	}
+
+	for _, tt := range tests {
+		if got := smbusPEC(tt.crc, tt.data...); got != tt.want {
+			t.Errorf("%s: got 0x%02X, want 0x%02X", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package gompsse
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"time"
+)
 
 type spiXferOption uint32
 
@@ -15,6 +19,11 @@ const (
 
 // Constants related to board pins when MPSSE operating in SPI mode
 const (
+	spiSCLK  = D0          // serial clock
+	spiMOSI  = D1          // serial data output (bidirectional data in 3-wire mode)
+	spiMISO  = D2          // serial data input (tied to D1 in 3-wire mode)
+	spiReady = gpioWaitPin // GPIOL1, slave ready/busy input when enabled
+
 	spiClockMaximum   = 30000000
 	spiClockDefault   = 12000000 // valid range: 0-30000000 (30 MHz)
 	spiLatencyDefault = 16       // 1-255 USB Hi-Speed, 2-255 USB Full-Speed
@@ -25,7 +34,7 @@ type spiOption uint32
 // Constants defining the available options in the SPI configuration struct.
 const (
 	// Known SPI operating modes
-	//   LIMITATION: libMPSSE only supports mode 0 and mode 2 (CPHA==2).
+	//   NOTE: modes 1 and 3 (CPHA==1) require a Hi-Speed MPSSE (H-series).
 	SPIMode0       spiOption = 0x00000000 // capture on RISE, propagate on FALL
 	SPIMode1       spiOption = 0x00000001 // capture on FALL, propagate on RISE
 	SPIMode2       spiOption = 0x00000002 // capture on FALL, propagate on RISE
@@ -50,6 +59,109 @@ const (
 	spiCSActiveDefault spiOption = spiCSActiveLow
 )
 
+// BitOrder selects the order in which the bits of each byte are shifted.
+type BitOrder uint8
+
+// Constants defining the supported bit orders.
+const (
+	MSBFirst BitOrder = iota // bit 7 of each byte shifted first
+	LSBFirst                 // bit 0 of each byte shifted first
+
+	spiBitOrderDefault = MSBFirst
+)
+
+func (o BitOrder) String() string {
+	switch o {
+	case MSBFirst:
+		return "MSB-first"
+	case LSBFirst:
+		return "LSB-first"
+	default:
+		return "Unknown"
+	}
+}
+
+// ClockRounding selects how a requested SCLK rate is rounded to one the MPSSE
+// can actually generate.
+type ClockRounding uint8
+
+// Constants defining the supported clock rounding policies.
+const (
+	ClockNotFaster ClockRounding = iota // fastest rate not above requested
+	ClockNearest                        // rate nearest to requested
+
+	spiClockRoundingDefault = ClockNotFaster
+)
+
+func (r ClockRounding) String() string {
+	switch r {
+	case ClockNotFaster:
+		return "Not-Faster"
+	case ClockNearest:
+		return "Nearest"
+	default:
+		return "Unknown"
+	}
+}
+
+// SPIReady selects the level of GPIOL1 (D5) with which a slave device signals
+// that it is ready to begin a frame.
+type SPIReady uint8
+
+// Constants defining the supported ready/busy handshake settings.
+const (
+	SPIReadyNone SPIReady = iota // no handshake
+	SPIReadyHigh                 // slave drives GPIOL1 HIGH when ready
+	SPIReadyLow                  // slave drives GPIOL1 LOW when ready
+)
+
+func (r SPIReady) String() string {
+	switch r {
+	case SPIReadyNone:
+		return "None"
+	case SPIReadyHigh:
+		return "High"
+	case SPIReadyLow:
+		return "Low"
+	default:
+		return "Unknown"
+	}
+}
+
+// wait returns the MPSSE opcode waiting until the slave is ready.
+func (r SPIReady) wait() uint8 {
+	if SPIReadyLow == r {
+		return mpsseWaitIOLow
+	}
+	return mpsseWaitIOHigh
+}
+
+// SPITiming holds the minimum delays inserted into the MPSSE command stream of
+// each SPI transfer, for devices that require more time than the clock rate
+// alone provides. Delays are generated by the MPSSE itself rather than by the
+// host, so USB latency does not affect them. Each delay is at most 1 ms, and
+// may be longer than requested (see mpsseSetByteTime).
+type SPITiming struct {
+	CSSetup   time.Duration // CS asserted to first SCLK edge
+	CSHold    time.Duration // last SCLK edge to CS deasserted
+	CSIdle    time.Duration // CS deasserted to end of frame
+	WordDelay time.Duration // between consecutive words of a transfer
+	WordSize  int           // bytes per word for WordDelay (0 for 1 byte)
+}
+
+// valid returns an error if any field of t is out of range.
+func (t SPITiming) valid() error {
+	for _, d := range []time.Duration{t.CSSetup, t.CSHold, t.CSIdle, t.WordDelay} {
+		if err := delayValid(d); nil != err {
+			return fmt.Errorf("invalid SPI timing: %v", err)
+		}
+	}
+	if t.WordSize < 0 {
+		return fmt.Errorf("invalid SPI timing: word size %d", t.WordSize)
+	}
+	return nil
+}
+
 // spiCSPin translates a DPin value to its corresponding chip-select mask for
 // the SPI configuration struct option.
 var spiCSPin = map[DPin]spiOption{
@@ -63,6 +175,33 @@ var spiCSPin = map[DPin]spiOption{
 	D7: spiCSD7,
 }
 
+// spiClocking describes how the MPSSE generates an SPI mode: the level of SCLK
+// while idle and the data shifting opcode flags selecting the clock edges on
+// which MOSI is propagated and MISO is captured.
+type spiClocking struct {
+	idle byte  // SCLK level while idle (PinLO or PinHI)
+	out  uint8 // mpsseDataOutNeg if MOSI changes on the falling edge
+	in   uint8 // mpsseDataInNeg if MISO is captured on the falling edge
+}
+
+// idleLevel returns the low-byte line values val with SCLK at its idle level.
+func (clk spiClocking) idleLevel(val uint8) uint8 {
+	if PinHI == clk.idle {
+		return val | uint8(spiSCLK)
+	}
+	return val & ^uint8(spiSCLK)
+}
+
+// spiModeClocking defines the spiClocking for each SPI mode. libMPSSE only sets
+// the SCLK idle level when its channel is initialized, so all data shifting is
+// performed with raw MPSSE commands selected from this table instead.
+var spiModeClocking = map[spiOption]spiClocking{
+	SPIMode0: {idle: PinLO, out: mpsseDataOutNeg, in: 0},
+	SPIMode1: {idle: PinLO, out: 0, in: mpsseDataInNeg},
+	SPIMode2: {idle: PinHI, out: 0, in: mpsseDataInNeg},
+	SPIMode3: {idle: PinHI, out: mpsseDataOutNeg, in: 0},
+}
+
 // spiDPinConfig represents the default direction and value for pins associated
 // with the lower byte lines of MPSSE, reserved for serial functions SPI/I²C
 // (or port "D" on FT232H), but has a few GPIO pins as well.
@@ -110,6 +249,12 @@ type spiConfig struct {
 	options   spiOption
 	pin       uint32 // port D pins ("low byte lines of MPSSE")
 	reserved  uint16
+	bitOrder  BitOrder   // not a libMPSSE option, applied per-transfer
+	cs        ChipSelect // CS line, if not the DPin selected by options
+	timing    SPITiming
+	rounding  ClockRounding
+	threeWire bool     // MOSI and MISO tied together as a bidirectional line
+	ready     SPIReady // ready/busy handshake on GPIOL1
 }
 
 func spiConfigDefault() *spiConfig {
@@ -119,35 +264,88 @@ func spiConfigDefault() *spiConfig {
 		options:   spiCSActiveDefault | spiCSDefault | spiModeDefault,
 		pin:       spiDPinConfigDefault(),
 		reserved:  0,
+		bitOrder:  spiBitOrderDefault,
+		rounding:  spiClockRoundingDefault,
 	}
 }
 
 type SPI struct {
-	device *MPSSE
-	config *spiConfig
+	device  *MPSSE
+	config  *spiConfig
+	hw      *spiConfig   // configuration currently programmed into the device
+	queue   spiQueue     // transfers submitted with SubmitTx
+	devices []*spiConfig // configurations of the handles returned by Device
 }
 
+// ChangeCS selects the DPin (D3-D7) used as chip-select. If the SPI channel is
+// initialized, the new CS pin is driven to its deasserted level immediately.
 func (spi *SPI) ChangeCS(cs DPin) error {
+	return spi.SetChipSelect(ChipSelectD(cs))
+}
 
-	var csOpt spiOption
+// SetOptions selects the chip-select pin and polarity and the SPI mode. If the
+// SPI channel is initialized, the changes take effect immediately.
+func (spi *SPI) SetOptions(cs DPin, activeLow bool, mode byte) error {
 
-	if csOpt, ok := spiCSPin[cs]; !ok || (spiCSInvalid == csOpt) {
-		return fmt.Errorf("invalid CS pin: %d", cs)
+	opt, err := spiOptions(cs, activeLow, mode)
+	if nil != err {
+		return err
 	}
 
-	spi.config.options &= ^(spiCSMask)
-	spi.config.options |= csOpt
+	cfg := *spi.config
+	cfg.options = opt
+	cfg.cs = ChipSelect{}
 
-	return nil
+	return spi.apply(&cfg)
 }
 
-func (spi *SPI) SetOptions(cs DPin, activeLow bool, mode byte) error {
+// SetConfig sets the clock rate, USB latency timer, chip-select pin and
+// polarity, and SPI mode. If the SPI channel is initialized, the changes take
+// effect immediately.
+func (spi *SPI) SetConfig(clock uint32, latency byte, cs DPin, activeLow bool, mode byte) error {
+
+	cfg := *spi.config
+
+	if 0 == clock {
+		cfg.clockRate = spiClockDefault
+	} else {
+		if clock <= spiClockMaximum {
+			cfg.clockRate = clock
+		} else {
+			return fmt.Errorf("invalid clock rate: %d", clock)
+		}
+	}
+
+	if 0 == latency {
+		cfg.latency = spiLatencyDefault
+	} else {
+		cfg.latency = latency
+	}
+
+	opt, err := spiOptions(cs, activeLow, mode)
+	if nil != err {
+		return err
+	}
+	cfg.options = opt
+	cfg.cs = ChipSelect{}
+
+	return spi.apply(&cfg)
+}
+
+// spiOptions returns the spiConfig options selecting the given chip-select pin
+// and polarity and SPI mode.
+func spiOptions(cs DPin, activeLow bool, mode byte) (spiOption, error) {
 
 	var (
 		activeOpt spiOption
 		modeOpt   spiOption
 	)
 
+	csOpt, ok := spiCSPin[cs]
+	if !ok || (spiCSInvalid == csOpt) {
+		return 0, fmt.Errorf("invalid CS pin: %d", cs)
+	}
+
 	if activeLow {
 		activeOpt = spiCSActiveLow
 	} else {
@@ -155,70 +353,727 @@ func (spi *SPI) SetOptions(cs DPin, activeLow bool, mode byte) error {
 	}
 
 	if spiOption(mode) > spiModeMask {
-		return fmt.Errorf("invalid SPI mode: Mode %d", mode)
+		return 0, fmt.Errorf("invalid SPI mode: Mode %d", mode)
 	} else {
 		modeOpt = spiOption(mode)
 	}
 
-	spi.config.options = activeOpt | modeOpt
-	return spi.ChangeCS(cs)
+	return activeOpt | modeOpt | csOpt, nil
 }
 
-func (spi *SPI) SetConfig(clock uint32, latency byte, cs DPin, activeLow bool, mode byte) error {
+// SetBitOrder selects whether data is shifted MSB-first (the default) or
+// LSB-first, using the MPSSE's native LSB-first data shifting opcodes.
+func (spi *SPI) SetBitOrder(order BitOrder) error {
+	switch order {
+	case MSBFirst, LSBFirst:
+		cfg := *spi.config
+		cfg.bitOrder = order
+		return spi.apply(&cfg)
+	default:
+		return fmt.Errorf("invalid bit order: %d", order)
+	}
+}
 
-	if 0 == clock {
-		spi.config.clockRate = spiClockDefault
-	} else {
-		if clock <= spiClockMaximum {
-			spi.config.clockRate = clock
-		} else {
-			return fmt.Errorf("invalid clock rate: %d", clock)
-		}
+// SetClockRounding selects how the configured clock rate is rounded to one the
+// MPSSE can generate. See ActualClock for the resulting rate.
+func (spi *SPI) SetClockRounding(round ClockRounding) error {
+	switch round {
+	case ClockNotFaster, ClockNearest:
+		cfg := *spi.config
+		cfg.rounding = round
+		return spi.apply(&cfg)
+	default:
+		return fmt.Errorf("invalid clock rounding: %d", round)
 	}
+}
 
-	if 0 == latency {
-		spi.config.latency = spiLatencyDefault
-	} else {
-		spi.config.latency = latency
+// SetThreeWire enables or disables 3-wire (half-duplex) mode, used with slave
+// devices having a single bidirectional data line connected to both D1 and D2.
+// In 3-wire mode, D1 is tristated while reading so that the slave can drive the
+// data line, and full-duplex transfers are not possible.
+func (spi *SPI) SetThreeWire(enable bool) error {
+	cfg := *spi.config
+	cfg.threeWire = enable
+	return spi.apply(&cfg)
+}
+
+// Tx writes w and then reads r within a single frame, with CS asserted for its
+// entire duration, such as when a command must be sent before its response can
+// be read. In 3-wire mode, the data line is turned around between w and r.
+func (spi *SPI) Tx(w []uint8, r []uint8) error {
+	_, err := spi.frame(spi.config, []spiPhase{
+		{w: w, nbits: 8 * len(w)},
+		{r: r, nbits: 8 * len(r)},
+	}, true, true)
+	return err
+}
+
+// SetReady enables or disables the ready/busy handshake. When enabled, the
+// MPSSE waits (without any USB round trip) until the slave signals ready on
+// GPIOL1 (D5) before asserting CS to begin each frame. Note that a frame is
+// blocked indefinitely if the slave never becomes ready; use WaitReady first
+// to wait with a timeout.
+func (spi *SPI) SetReady(ready SPIReady) error {
+	switch ready {
+	case SPIReadyNone, SPIReadyHigh, SPIReadyLow:
+		cfg := *spi.config
+		cfg.ready = ready
+		return spi.apply(&cfg)
+	default:
+		return fmt.Errorf("invalid ready setting: %d", ready)
 	}
+}
 
-	return spi.SetOptions(cs, activeLow, mode)
+// WaitReady waits at most timeout for the slave to signal ready on GPIOL1 (D5),
+// returning ErrTimeout if it does not. The ready/busy handshake must be enabled
+// with SetReady.
+func (spi *SPI) WaitReady(timeout time.Duration) error {
+	return spi.waitReady(spi.config, timeout)
+}
+
+// SetTiming sets the CS setup, hold and idle times and the inter-word delay
+// inserted into each transfer.
+func (spi *SPI) SetTiming(t SPITiming) error {
+	if err := t.valid(); nil != err {
+		return err
+	}
+	cfg := *spi.config
+	cfg.timing = t
+	return spi.apply(&cfg)
 }
 
 func (spi *SPI) Init() error {
 
-	if err := _SPI_InitChannel(spi); nil != err {
+	if err := spi.config.check(spi.device.info); nil != err {
+		return err
+	}
+	clk, _ := spi.config.clocking(spi.device.info)
+
+	spi.device.lock()
+	err := _SPI_InitChannel(spi)
+	spi.device.mu.Unlock()
+	if nil != err {
 		return err
 	}
 
 	spi.device.mode = ModeSPI
 
-	return spi.device.GPIO.Init() // reset GPIO
+	// libMPSSE drives the low-byte lines to their initial state (with CS
+	// deasserted), which is tracked from here on as we drive them ourselves.
+	spi.device.low.dir = uint8(spi.config.pin) | spi.config.csPin()
+	spi.device.low.val = spi.config.csLevel(clk.idleLevel(uint8(spi.config.pin>>8)),
+		spi.config.csPin(), false)
+	hw := *spi.config
+	hw.cs = ChipSelect{}
+	hw.clockRate = 0 // replace the divisor computed by libMPSSE with our own
+	spi.hw = &hw
+
+	if err := spi.device.GPIO.Init(); nil != err { // reset GPIO
+		return err
+	}
+
+	if err := spi.use(spi.config); nil != err { // set clock, deassert CS if not a DPin
+		return err
+	}
+
+	return spi.deselectAll()
 }
 
 func (spi *SPI) Write(data []uint8, start bool, stop bool) (uint32, error) {
-	opt := spiXferBytes
-	if start {
-		opt |= spiCSAssert
+	n, err := spi.xfer(spi.config, data, nil, 8*len(data), start, stop)
+	return n / 8, err
+}
+
+func (spi *SPI) Read(data []uint8, start bool, stop bool) (uint32, error) {
+	n, err := spi.xfer(spi.config, nil, data, 8*len(data), start, stop)
+	return n / 8, err
+}
+
+// Transfer simultaneously writes out and reads in (full-duplex). Both slices
+// must have the same length.
+func (spi *SPI) Transfer(out []uint8, in []uint8, start bool, stop bool) (uint32, error) {
+	if len(out) != len(in) {
+		return 0, fmt.Errorf("transfer length mismatch: %d != %d", len(out), len(in))
 	}
-	if stop {
-		opt |= spiCSDeAssert
+	n, err := spi.xfer(spi.config, out, in, 8*len(out), start, stop)
+	return n / 8, err
+}
+
+// WriteBits writes the first nbits bits of data, for devices whose frames are
+// not a multiple of 8 bits long. With MSB-first bit order, bits are sent in
+// order starting from the most significant bit of data[0], so a partial final
+// byte must be left-aligned; e.g., the 12-bit frame 0xABC is given as
+// []uint8{0xAB, 0xC0}. With LSB-first bit order, bits are sent starting from
+// the least significant bit of data[0], and a partial final byte must be
+// right-aligned. Returns the number of bits written.
+func (spi *SPI) WriteBits(data []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	if nbits < 0 || (nbits+7)/8 > len(data) {
+		return 0, fmt.Errorf("invalid bit count: %d", nbits)
+	}
+	return spi.xfer(spi.config, data, nil, nbits, start, stop)
+}
+
+// ReadBits reads nbits bits into data, using the same bit order and alignment
+// as WriteBits. Returns the number of bits read.
+func (spi *SPI) ReadBits(data []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	if nbits < 0 || (nbits+7)/8 > len(data) {
+		return 0, fmt.Errorf("invalid bit count: %d", nbits)
+	}
+	return spi.xfer(spi.config, nil, data, nbits, start, stop)
+}
+
+// TransferBits simultaneously writes and reads nbits bits (full-duplex), using
+// the same bit order and alignment as WriteBits. Returns the number of bits
+// transferred.
+func (spi *SPI) TransferBits(out []uint8, in []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	if nbits < 0 || (nbits+7)/8 > len(out) || (nbits+7)/8 > len(in) {
+		return 0, fmt.Errorf("invalid bit count: %d", nbits)
 	}
-	return _SPI_Write(spi, data, opt)
+	return spi.xfer(spi.config, out, in, nbits, start, stop)
 }
 
+// WriteWith writes data using the given CPin as chip-select instead of the
+// configured CS line.
 func (spi *SPI) WriteWith(cs CPin, data []uint8, start bool, stop bool) (uint32, error) {
+	cfg := *spi.config
+	if err := cfg.setChipSelect(ChipSelectC(cs)); nil != err {
+		return 0, err
+	}
+	n, err := spi.xfer(&cfg, data, nil, 8*len(data), start, stop)
+	return n / 8, err
+}
+
+// clocking returns the spiClocking of the configured SPI mode, verifying the
+// mode can be generated by the device info.
+func (cfg *spiConfig) clocking(info *deviceInfo) (spiClocking, error) {
+	mode := cfg.options & spiModeMask
+	if 0 != mode&SPIMode1 && !info.isHiSpeedMPSSE() {
+		return spiClocking{}, fmt.Errorf("SPI mode %d not supported on %s",
+			mode, info.chip)
+	}
+	return spiModeClocking[mode], nil
+}
+
+// check returns an error if cfg cannot be generated by the device info.
+func (cfg *spiConfig) check(info *deviceInfo) error {
+	if _, err := cfg.clocking(info); nil != err {
+		return err
+	}
+	if SPIReadyNone != cfg.ready && uint8(spiReady) == cfg.csPin() {
+		return fmt.Errorf("CS pin in use by ready/busy handshake: %d", spiReady)
+	}
+	_, err := cfg.divisor(info)
+	return err
+}
+
+// csPin returns the low-byte line mask of the configured CS pin, or 0 if CS is
+// not on the low-byte lines.
+func (cfg *spiConfig) csPin() uint8 {
+	if csHardware != cfg.cs.kind {
+		return 0
+	}
+	return uint8(D3) << ((cfg.options & spiCSMask) >> 2)
+}
+
+// csPins returns the mask of low-byte lines used as CS by the bus, by any of
+// its device handles, or by the configuration currently in effect.
+func (spi *SPI) csPins() uint8 {
+	mask := spi.config.csPin()
+	if nil != spi.hw {
+		mask |= spi.hw.csPin()
+	}
+	for _, cfg := range spi.devices {
+		mask |= cfg.csPin()
+	}
+	return mask
+}
+
+// csLevel returns the line values val with the CS line(s) in mask driven to
+// their asserted (if assert is true) or deasserted level.
+func (cfg *spiConfig) csLevel(val uint8, mask uint8, assert bool) uint8 {
+	activeLow := 0 != cfg.options&spiCSActiveLow
+	if assert != activeLow {
+		return val | mask
+	}
+	return val & ^mask
+}
+
+// spiClock holds an MPSSE clock divisor and the SCLK rate it generates.
+type spiClock struct {
+	div5 bool    // enable divide-by-5 prescaler (Hi-Speed MPSSE only)
+	div  uint16  // clock divisor
+	rate float64 // resulting SCLK rate in Hertz
+}
+
+// spiClockDivisor computes the MPSSE clock divisor generating the SCLK rate
+// closest to the given clock that is permitted by the rounding policy. The
+// MPSSE generates SCLK as base/(1+div), where base is 30 MHz, or 6 MHz with the
+// divide-by-5 prescaler enabled (the only base available on a full-speed
+// MPSSE), and div is 16 bits.
+func spiClockDivisor(info *deviceInfo, clock uint32, round ClockRounding) (spiClock, error) {
+
+	type source struct {
+		div5 bool
+		base uint32
+	}
 
-	assert := 0 == uint32(spiCSActiveLow&spi.config.options)
+	src := []source{{div5: true, base: 6000000}}
+	if info.isHiSpeedMPSSE() {
+		src = []source{{div5: false, base: 30000000}, {div5: true, base: 6000000}}
+	}
+
+	var (
+		best  spiClock
+		found bool
+	)
+	for _, s := range src {
+		// candidate divisors (+1) bracketing the exact ratio base/clock
+		for _, q := range []uint32{s.base / clock, (s.base + clock - 1) / clock} {
+			if q < 1 {
+				q = 1
+			} else if q > 0x10000 {
+				q = 0x10000
+			}
+			rate := float64(s.base) / float64(q)
+			if ClockNotFaster == round && rate > float64(clock) {
+				continue
+			}
+			if !found || math.Abs(rate-float64(clock)) < math.Abs(best.rate-float64(clock)) {
+				best = spiClock{div5: s.div5, div: uint16(q - 1), rate: rate}
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return spiClock{}, fmt.Errorf("clock rate not attainable: %d", clock)
+	}
+	return best, nil
+}
+
+// divisor returns the spiClock generating the configured clock rate.
+func (cfg *spiConfig) divisor(info *deviceInfo) (spiClock, error) {
+	return spiClockDivisor(info, cfg.clockRate, cfg.rounding)
+}
+
+// ActualClock returns the SCLK rate (in Hertz, rounded down) that the MPSSE
+// generates for the configured clock rate, which may differ from the requested
+// rate because SCLK can only be an integer fraction of the master clock.
+func (spi *SPI) ActualClock() uint32 {
+	clk, err := spi.config.divisor(spi.device.info)
+	if nil != err {
+		return 0
+	}
+	return uint32(clk.rate)
+}
+
+// apply replaces the SPI configuration with cfg, reprogramming the device if the
+// SPI channel is initialized. The configuration is left unchanged if cfg is not
+// supported by the device or cannot be programmed.
+func (spi *SPI) apply(cfg *spiConfig) error {
+
+	if ModeSPI == spi.device.mode {
+		if err := spi.use(cfg); nil != err {
+			return err
+		}
+	} else if err := cfg.check(spi.device.info); nil != err {
+		return err
+	}
+
+	*spi.config = *cfg
+	return nil
+}
+
+// spiState holds the line states and configuration that a command sequence
+// leaves programmed in the device once it has been executed.
+type spiState struct {
+	low  gpioConfig
+	high gpioConfig
+	hw   spiConfig
+}
+
+// state returns the current spiState of the device.
+func (spi *SPI) state() spiState {
+	return spiState{
+		low:  *spi.device.low,
+		high: *spi.device.GPIO.config,
+		hw:   *spi.hw,
+	}
+}
+
+// commit records st as the current spiState of the device.
+func (spi *SPI) commit(st *spiState) {
+	*spi.device.low = st.low
+	*spi.device.GPIO.config = st.high
+	*spi.hw = st.hw
+}
+
+// use reprograms the device with any settings of cfg that differ from those
+// currently in effect. Nothing is sent to the device if cfg is already in
+// effect.
+func (spi *SPI) use(cfg *spiConfig) error {
+
+	st := spi.state()
+	cmd := &mpsseCmd{}
+
+	if err := spi.prepare(cfg, cmd, &st); nil != err {
+		return err
+	}
+
+	if err := spi.latency(&st); nil != err {
+		return err
+	}
+	if _, err := spi.device.exec(cmd); nil != err {
+		return err
+	}
+
+	spi.commit(&st)
+	return nil
+}
+
+// latency programs the USB latency timer of the configuration in st, if it
+// differs from that in effect, just before the commands leading to st are sent.
+func (spi *SPI) latency(st *spiState) error {
+	if st.hw.latency == spi.hw.latency {
+		return nil
+	}
+	if err := _FT_SetLatencyTimer(spi.device, st.hw.latency); nil != err {
+		return err
+	}
+	spi.hw.latency = st.hw.latency
+	return nil
+}
+
+// prepare appends to cmd the commands reprogramming any settings of cfg that
+// differ from those in st, updating st accordingly, so that multiple devices
+// with different configurations can share the SPI bus.
+func (spi *SPI) prepare(cfg *spiConfig, cmd *mpsseCmd, st *spiState) error {
+
+	if ModeSPI != spi.device.mode {
+		return fmt.Errorf("SPI channel not initialized")
+	}
+
+	if *cfg == st.hw {
+		return nil
+	}
+
+	if err := cfg.check(spi.device.info); nil != err {
+		return err
+	}
+	clk, _ := cfg.clocking(spi.device.info)
+
+	if cfg.clockRate != st.hw.clockRate || cfg.rounding != st.hw.rounding {
+		div, err := cfg.divisor(spi.device.info)
+		if nil != err {
+			return err
+		}
+		cmd.setClock(div.div5, div.div, spi.device.info.isHiSpeedMPSSE())
+	}
+
+	// drive SCLK to its (possibly new) idle level and the (possibly new) CS
+	// line to its deasserted level before any transfer begins.
+	st.low.val = clk.idleLevel(st.low.val)
+	if SPIReadyNone != cfg.ready {
+		st.low.dir &= ^uint8(spiReady)
+	}
+	cmd.setLow(st.low.val, st.low.dir, 1)
+	cfg.selectCmd(cmd, &st.low, &st.high, false)
+
+	st.hw = *cfg
+	return nil
+}
+
+// waitReady waits at most timeout for the slave using SPI configuration cfg to
+// signal ready, using a wait-on-I/O command followed by a read-back marker that
+// is returned only once the wait completes.
+func (spi *SPI) waitReady(cfg *spiConfig, timeout time.Duration) error {
+
+	if SPIReadyNone == cfg.ready {
+		return fmt.Errorf("ready/busy handshake not enabled")
+	}
+
+	st := spi.state()
+	cmd := &mpsseCmd{}
+
+	if err := spi.prepare(cfg, cmd, &st); nil != err {
+		return err
+	}
+	cmd.append(cfg.ready.wait())
+	cmd.getLow() // marker
+
+	// the reconfiguration commands preceding the wait are executed whether or
+	// not the wait times out, but are replayed by restore when it does.
+	if err := spi.latency(&st); nil != err {
+		return err
+	}
+	spi.commit(&st)
+
+	_, err := spi.device.execTimeout(cmd, timeout)
+	return err
+}
+
+// restore reprograms the device with the last committed SPI state after the
+// MPSSE has been reset. The caller must hold the device lock.
+func (spi *SPI) restore() error {
+
+	cmd := &mpsseCmd{}
+	cmd.append(mpsseLoopbackOff)
+	cmd.setLow(spi.device.low.val, spi.device.low.dir, 1)
+	cmd.setHigh(spi.device.GPIO.config.val, spi.device.GPIO.config.dir)
+
+	hw := *spi.hw
+	spi.hw.clockRate = 0 // force the clock to be reprogrammed
+	st := spi.state()
+	if err := spi.prepare(&hw, cmd, &st); nil != err {
+		return err
+	}
+
+	if err := spi.latency(&st); nil != err {
+		return err
+	}
+	if err := spi.device.send(cmd); nil != err {
+		return err
+	}
+	spi.commit(&st)
+	return nil
+}
+
+// deselect deasserts CS after a failed transfer. Errors are ignored, as the
+// error that caused the transfer to fail is more useful to the caller.
+func (spi *SPI) deselect(cfg *spiConfig) {
+	spi.device.lock()
+	spi.deselectLocked(cfg)
+	spi.device.mu.Unlock()
+	_ = cfg.selectFunc(false)
+}
+
+// deselectLocked deasserts CS, unless it is a user function, like deselect. The
+// caller must hold the device lock.
+func (spi *SPI) deselectLocked(cfg *spiConfig) {
+	st := spi.state()
+	cmd := &mpsseCmd{}
+	cfg.selectCmd(cmd, &st.low, &st.high, false)
+	if nil == spi.device.send(cmd) {
+		spi.commit(&st)
+	}
+}
+
+// deselectAll drives the CS line of every device handle to its deasserted
+// level, without changing the configuration in effect.
+func (spi *SPI) deselectAll() error {
+
+	if 0 == len(spi.devices) {
+		return nil
+	}
+
+	st := spi.state()
+	cmd := &mpsseCmd{}
+	for _, cfg := range spi.devices {
+		cfg.selectCmd(cmd, &st.low, &st.high, false)
+	}
+	if _, err := spi.device.exec(cmd); nil != err {
+		return err
+	}
+	spi.commit(&st)
+
+	for _, cfg := range spi.devices {
+		if err := cfg.selectFunc(false); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// xfer shifts out nbits bits of w while shifting in nbits bits to r, using the
+// SPI configuration cfg, and returns the number of bits transferred. either w
+// or r may be nil for a write-only or read-only transfer, respectively. CS is
+// asserted before the transfer if start is true and deasserted after it if
+// stop is true. CS is always deasserted if the transfer fails.
+func (spi *SPI) xfer(cfg *spiConfig, w []uint8, r []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	return spi.frame(cfg, []spiPhase{{w: w, r: r, nbits: nbits}}, start, stop)
+}
+
+// spiPhase is one data phase of an SPI frame, shifting out nbits bits of w
+// while shifting in nbits bits to r (either of which may be nil).
+type spiPhase struct {
+	w     []uint8
+	r     []uint8
+	nbits int
+}
+
+// frame performs each of the given data phases in order within a single MPSSE
+// command stream, returning the total number of bits transferred. CS is
+// asserted before the first phase if start is true and deasserted after the
+// last phase if stop is true. CS is always deasserted if the transfer fails.
+func (spi *SPI) frame(cfg *spiConfig, phase []spiPhase, start bool, stop bool) (uint32, error) {
+
+	st := spi.state()
+	cmd := &mpsseCmd{}
+
+	nbits, err := spi.build(cfg, phase, start, stop, cmd, &st)
+	if nil != err {
+		return 0, err
+	}
+
+	if err := spi.latency(&st); nil != err {
+		return 0, err
+	}
 
 	if start {
-		if err := spi.device.GPIO.Set(cs, assert); nil != err {
+		if err := cfg.selectFunc(true); nil != err {
 			return 0, err
 		}
 	}
+
+	in, err := spi.device.exec(cmd)
+	if nil != err {
+		spi.deselect(cfg)
+		return 0, err
+	}
+	spi.commit(&st)
+
+	if stop {
+		if err := cfg.selectFunc(false); nil != err {
+			return uint32(nbits), err
+		}
+	}
+
+	cfg.unpack(phase, in)
+
+	return uint32(nbits), nil
+}
+
+// build appends to cmd the commands performing an SPI frame with the given data
+// phases, updating st with the state the device will have once they have been
+// executed, and returns the total number of bits transferred. A user CS
+// function is not called.
+func (spi *SPI) build(cfg *spiConfig, phase []spiPhase, start bool, stop bool, cmd *mpsseCmd, st *spiState) (int, error) {
+
+	if cfg.threeWire {
+		for _, ph := range phase {
+			if nil != ph.w && nil != ph.r && ph.nbits > 0 {
+				return 0, fmt.Errorf("full-duplex transfer not possible in 3-wire mode")
+			}
+		}
+	}
+
+	if err := spi.prepare(cfg, cmd, st); nil != err {
+		return 0, err
+	}
+
+	clk, err := cfg.clocking(spi.device.info)
+	if nil != err {
+		return 0, err
+	}
+
+	if start {
+		if SPIReadyNone != cfg.ready {
+			cmd.append(cfg.ready.wait())
+		}
+		cfg.selectCmd(cmd, &st.low, &st.high, true)
+		cmd.delay(st.low.val, st.low.dir, cfg.timing.CSSetup)
+	}
+
+	var nbits int
+	for _, ph := range phase {
+		if 0 == ph.nbits {
+			continue
+		}
+		if cfg.threeWire && nil != ph.r {
+			// release the shared data line so the slave can drive it
+			st.low.dir &= ^uint8(spiMOSI)
+			cmd.setLow(st.low.val, st.low.dir, 1)
+		}
+		cfg.shift(cmd, st, clk, ph.w, ph.r, ph.nbits)
+		if cfg.threeWire && nil != ph.r {
+			st.low.dir |= uint8(spiMOSI)
+			cmd.setLow(st.low.val, st.low.dir, 1)
+		}
+		nbits += ph.nbits
+	}
+
 	if stop {
-		defer func() { _ = spi.device.GPIO.Set(cs, !assert) }()
+		cmd.delay(st.low.val, st.low.dir, cfg.timing.CSHold)
+		cfg.selectCmd(cmd, &st.low, &st.high, false)
+		cmd.delay(st.low.val, st.low.dir, cfg.timing.CSIdle)
+	}
+
+	return nbits, nil
+}
+
+// unpack copies the output in of a frame built with the given data phases into
+// the read buffers of each phase.
+func (cfg *spiConfig) unpack(phase []spiPhase, in []uint8) {
+	for _, ph := range phase {
+		if 0 == ph.nbits || nil == ph.r {
+			continue
+		}
+		n, rem := ph.nbits/8, ph.nbits%8
+		if rem > 0 {
+			// bits are shifted in from the opposite end of the byte they are
+			// shifted out from, so align the partial byte as it would be written
+			if LSBFirst == cfg.bitOrder {
+				in[n] >>= uint(8 - rem)
+			} else {
+				in[n] <<= uint(8 - rem)
+			}
+			n++
+		}
+		copy(ph.r, in[:n])
+		in = in[n:]
+	}
+}
+
+// shift appends to cmd the data shifting commands for nbits bits of w and r,
+// inserting the configured inter-word delay between words. Nothing is appended
+// for a zero-length transfer, which only asserts or deasserts CS.
+func (cfg *spiConfig) shift(cmd *mpsseCmd, st *spiState, clk spiClocking, w []uint8, r []uint8, nbits int) {
+
+	if 0 == nbits {
+		return
+	}
+
+	var op uint8
+	if nil != w {
+		op |= mpsseDataOut | clk.out
+	}
+	if nil != r {
+		op |= mpsseDataIn | clk.in
+	}
+	if LSBFirst == cfg.bitOrder {
+		op |= mpsseDataLSBFirst
 	}
 
-	return _SPI_Write(spi, data, spiXferBytes)
+	n, rem := nbits/8, nbits%8
+	size := n
+	if cfg.timing.WordDelay > 0 {
+		size = 1
+		if cfg.timing.WordSize > 0 {
+			size = cfg.timing.WordSize
+		}
+	}
+	for pos := 0; pos < n; pos += size {
+		if pos > 0 {
+			cmd.delay(st.low.val, st.low.dir, cfg.timing.WordDelay)
+		}
+		end := pos + size
+		if end > n {
+			end = n
+		}
+		var out []uint8
+		if nil != w {
+			out = w[pos:end]
+		}
+		cmd.shiftBytes(op, out, end-pos)
+	}
+	if rem > 0 {
+		if n > 0 && 0 == n%size {
+			cmd.delay(st.low.val, st.low.dir, cfg.timing.WordDelay)
+		}
+		var last uint8
+		if nil != w {
+			last = w[n]
+		}
+		cmd.shiftBits(op, last, rem)
+	}
 }
@@ -0,0 +1,150 @@
+package gompsse
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestSPIClockDivisor(t *testing.T) {
+
+	hi := &deviceInfo{chip: FT232H}
+	full := &deviceInfo{chip: FT2232C}
+
+	tests := []struct {
+		name  string
+		info  *deviceInfo
+		clock uint32
+		round ClockRounding
+		err   bool
+		div5  bool
+		div   uint16
+		rate  float64
+	}{
+		{"max", hi, 30000000, ClockNotFaster, false, false, 0, 30000000},
+		{"exact", hi, 1000000, ClockNotFaster, false, false, 29, 1000000},
+		{"not faster", hi, 7000000, ClockNotFaster, false, false, 4, 6000000},
+		{"nearest", hi, 7000000, ClockNearest, false, false, 3, 7500000},
+		{"prescaler", hi, 100, ClockNotFaster, false, true, 59999, 100},
+		{"too slow", hi, 10, ClockNotFaster, true, false, 0, 0},
+		{"too slow nearest", hi, 10, ClockNearest, false, true, 0xFFFF, 6000000.0 / 0x10000},
+		{"full speed max", full, 12000000, ClockNotFaster, false, true, 0, 6000000},
+		{"full speed", full, 1000000, ClockNotFaster, false, true, 5, 1000000},
+	}
+
+	for _, tt := range tests {
+		clk, err := spiClockDivisor(tt.info, tt.clock, tt.round)
+		if tt.err {
+			if nil == err {
+				t.Errorf("%s: expected error, got %+v", tt.name, clk)
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if clk.div5 != tt.div5 || clk.div != tt.div || math.Abs(clk.rate-tt.rate) > 1e-6 {
+			t.Errorf("%s: got %+v, want {div5:%t div:%d rate:%g}",
+				tt.name, clk, tt.div5, tt.div, tt.rate)
+		}
+	}
+}
+
+func TestSPIModeClocking(t *testing.T) {
+
+	hi := &deviceInfo{chip: FT232H}
+	full := &deviceInfo{chip: FT2232C}
+
+	tests := []struct {
+		name string
+		info *deviceInfo
+		mode byte
+		err  bool
+		want spiClocking
+	}{
+		{"mode 0", hi, 0, false, spiClocking{idle: PinLO, out: mpsseDataOutNeg, in: 0}},
+		{"mode 1", hi, 1, false, spiClocking{idle: PinLO, out: 0, in: mpsseDataInNeg}},
+		{"mode 2", hi, 2, false, spiClocking{idle: PinHI, out: 0, in: mpsseDataInNeg}},
+		{"mode 3", hi, 3, false, spiClocking{idle: PinHI, out: mpsseDataOutNeg, in: 0}},
+		{"full speed mode 0", full, 0, false, spiClocking{idle: PinLO, out: mpsseDataOutNeg, in: 0}},
+		{"full speed mode 1", full, 1, true, spiClocking{}},
+		{"full speed mode 2", full, 2, false, spiClocking{idle: PinHI, out: 0, in: mpsseDataInNeg}},
+		{"full speed mode 3", full, 3, true, spiClocking{}},
+		{"invalid mode", hi, 4, true, spiClocking{}},
+	}
+
+	for _, tt := range tests {
+		opt, err := spiOptions(D3, true, tt.mode)
+		var clk spiClocking
+		if nil == err {
+			cfg := &spiConfig{options: opt}
+			clk, err = cfg.clocking(tt.info)
+		}
+		if tt.err {
+			if nil == err {
+				t.Errorf("%s: expected error, got %+v", tt.name, clk)
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if clk != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, clk, tt.want)
+		}
+	}
+}
+
+func TestSPIUnpack(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		order BitOrder
+		nbits []int  // bits of each phase
+		read  []bool // phase reads data
+		in    []uint8
+		want  [][]uint8
+	}{
+		{"bytes", MSBFirst, []int{16}, []bool{true},
+			[]uint8{0xAB, 0xCD}, [][]uint8{{0xAB, 0xCD}}},
+		{"partial msb", MSBFirst, []int{12}, []bool{true},
+			[]uint8{0xAB, 0x0C}, [][]uint8{{0xAB, 0xC0}}},
+		{"partial lsb", LSBFirst, []int{12}, []bool{true},
+			[]uint8{0xAB, 0xC0}, [][]uint8{{0xAB, 0x0C}}},
+		{"write phase", MSBFirst, []int{8, 8}, []bool{false, true},
+			[]uint8{0x5A}, [][]uint8{nil, {0x5A}}},
+		{"empty phase", MSBFirst, []int{0, 3, 8}, []bool{true, true, true},
+			[]uint8{0x05, 0x77}, [][]uint8{{}, {0xA0}, {0x77}}},
+	}
+
+	for _, tt := range tests {
+		cfg := &spiConfig{bitOrder: tt.order}
+		phase := make([]spiPhase, len(tt.nbits))
+		for i, n := range tt.nbits {
+			phase[i].nbits = n
+			if tt.read[i] {
+				phase[i].r = make([]uint8, (n+7)/8)
+			}
+		}
+		cfg.unpack(phase, append([]uint8{}, tt.in...))
+		for i, ph := range phase {
+			if !bytes.Equal(ph.r, tt.want[i]) {
+				t.Errorf("%s: phase %d: got % X, want % X", tt.name, i, ph.r, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSPIShiftEmpty(t *testing.T) {
+
+	cfg := &spiConfig{timing: SPITiming{WordDelay: mpsseMaxDelay}}
+	for _, w := range [][]uint8{nil, {}} {
+		cmd := &mpsseCmd{}
+		cfg.shift(cmd, &spiState{}, spiClocking{}, w, w, 0)
+		if 0 != len(cmd.buf) || 0 != cmd.rx {
+			t.Errorf("shift(%v): got % X (rx %d), want nothing", w, cmd.buf, cmd.rx)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gompsse
+
+import "fmt"
+
+// Constants identifying the kind of line used as chip-select.
+const (
+	csHardware = iota // DPin selected by the SPI configuration options
+	csHighByte        // CPin on the MPSSE high-byte lines
+	csCallback        // user-provided function
+)
+
+// ChipSelect identifies the line used as chip-select for an SPI peripheral: a
+// DPin (D3-D7), any CPin, or a user function for a CS line that is not wired
+// to the MPSSE at all (e.g., behind an I/O expander). DPin and CPin lines are
+// driven from within the MPSSE command stream with the polarity configured for
+// the SPI bus or device; a function is called with assert=true before CS is to
+// be asserted and with assert=false after CS is to be deasserted, and is
+// responsible for its own polarity.
+//
+// The zero value selects the DPin given by the SPI configuration options.
+type ChipSelect struct {
+	kind int
+	pin  uint8
+	fn   *chipSelectFunc
+}
+
+// chipSelectFunc wraps a user CS function so that ChipSelect is comparable.
+type chipSelectFunc struct {
+	call func(assert bool) error
+}
+
+// ChipSelectD returns a ChipSelect using the given DPin (D3-D7).
+func ChipSelectD(pin DPin) ChipSelect {
+	return ChipSelect{kind: csHardware, pin: uint8(pin)}
+}
+
+// ChipSelectC returns a ChipSelect using the given CPin.
+func ChipSelectC(pin CPin) ChipSelect {
+	return ChipSelect{kind: csHighByte, pin: uint8(pin)}
+}
+
+// ChipSelectFunc returns a ChipSelect calling fn to assert and deassert CS.
+func ChipSelectFunc(fn func(assert bool) error) ChipSelect {
+	return ChipSelect{kind: csCallback, fn: &chipSelectFunc{call: fn}}
+}
+
+func (cs ChipSelect) String() string {
+	switch cs.kind {
+	case csHardware:
+		if 0 == cs.pin {
+			return "default"
+		}
+		return fmt.Sprintf("D-pin 0x%02X", cs.pin)
+	case csHighByte:
+		return fmt.Sprintf("C-pin 0x%02X", cs.pin)
+	case csCallback:
+		return "callback"
+	default:
+		return "Unknown"
+	}
+}
+
+// SetChipSelect selects the line used as chip-select. If the SPI channel is
+// initialized, the change takes effect immediately.
+func (spi *SPI) SetChipSelect(cs ChipSelect) error {
+	cfg := *spi.config
+	if err := cfg.setChipSelect(cs); nil != err {
+		return err
+	}
+	return spi.apply(&cfg)
+}
+
+// setChipSelect stores cs in the configuration, translating a DPin into the
+// equivalent libMPSSE CS option.
+func (cfg *spiConfig) setChipSelect(cs ChipSelect) error {
+
+	switch cs.kind {
+	case csHardware:
+		if 0 == cs.pin {
+			cs.pin = uint8(D3)
+		}
+		csOpt, ok := spiCSPin[DPin(cs.pin)]
+		if !ok || (spiCSInvalid == csOpt) {
+			return fmt.Errorf("invalid CS pin: %d", cs.pin)
+		}
+		cfg.options &= ^(spiCSMask)
+		cfg.options |= csOpt
+		cfg.cs = ChipSelect{}
+
+	case csHighByte:
+		if 0 == cs.pin {
+			return fmt.Errorf("invalid CS pin: %d", cs.pin)
+		}
+		cfg.cs = cs
+
+	case csCallback:
+		if nil == cs.fn || nil == cs.fn.call {
+			return fmt.Errorf("invalid CS function")
+		}
+		cfg.cs = cs
+
+	default:
+		return fmt.Errorf("invalid chip-select: %s", cs)
+	}
+
+	return nil
+}
+
+// selectCmd appends to cmd the commands asserting (if assert is true) or
+// deasserting CS, updating the low-byte and high-byte line states low and high
+// accordingly. Nothing is appended if CS is a user function.
+func (cfg *spiConfig) selectCmd(cmd *mpsseCmd, low *gpioConfig, high *gpioConfig, assert bool) {
+	switch cfg.cs.kind {
+	case csHardware:
+		low.dir |= cfg.csPin()
+		low.val = cfg.csLevel(low.val, cfg.csPin(), assert)
+		cmd.setLow(low.val, low.dir, 1)
+	case csHighByte:
+		high.dir |= cfg.cs.pin
+		high.val = cfg.csLevel(high.val, cfg.cs.pin, assert)
+		cmd.setHigh(high.val, high.dir)
+	}
+}
+
+// selectFunc calls the user CS function, if any, to assert or deassert CS.
+func (cfg *spiConfig) selectFunc(assert bool) error {
+	if csCallback == cfg.cs.kind {
+		return cfg.cs.fn.call(assert)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package gompsse
+
+import (
+	"fmt"
+	"time"
+)
+
+// SPIDeviceOptions holds the settings of a single peripheral attached to an
+// SPI bus. Zero values select the defaults of the bus, including an active-low
+// chip-select.
+type SPIDeviceOptions struct {
+	Clock      uint32   // SCLK rate in Hertz (0 for default)
+	Mode       byte     // SPI mode 0-3
+	CS         DPin     // chip-select pin D3-D7 (0 for default)
+	ActiveHigh bool     // drive CS high to assert
+	BitOrder   BitOrder // MSBFirst or LSBFirst
+
+	Rounding ClockRounding // ClockNotFaster or ClockNearest
+
+	Timing SPITiming // CS setup/hold/idle and inter-word delays
+
+	ThreeWire bool // single bidirectional data line tied to D1 and D2
+
+	Ready SPIReady // ready/busy handshake on GPIOL1 (D5)
+
+	// ChipSelect, if not the zero value, selects a CS line other than a DPin
+	// and overrides CS. ActiveHigh applies to a CPin as well.
+	ChipSelect ChipSelect
+}
+
+// SPIDevice is a handle to one peripheral on a shared SPI bus. Each handle
+// remembers its own configuration, which is applied to the device before each
+// transfer whenever it differs from the configuration last used on the bus.
+type SPIDevice struct {
+	bus    *SPI
+	config *spiConfig
+}
+
+// Device returns a handle to the peripheral on the SPI bus with the given
+// options. The bus must still be initialized with Init before use. The CS line
+// of the peripheral is driven to its deasserted level now if the bus is
+// initialized, and otherwise by Init, so that it is never left selected while
+// other peripherals are being clocked.
+func (spi *SPI) Device(opts SPIDeviceOptions) (*SPIDevice, error) {
+
+	cfg := *spi.config
+
+	if 0 == opts.Clock {
+		cfg.clockRate = spiClockDefault
+	} else if opts.Clock <= spiClockMaximum {
+		cfg.clockRate = opts.Clock
+	} else {
+		return nil, fmt.Errorf("invalid clock rate: %d", opts.Clock)
+	}
+
+	if 0 == opts.CS {
+		opts.CS = D3
+	}
+	opt, err := spiOptions(opts.CS, !opts.ActiveHigh, opts.Mode)
+	if nil != err {
+		return nil, err
+	}
+	cfg.options = opt
+	cfg.cs = ChipSelect{}
+	if (ChipSelect{}) != opts.ChipSelect {
+		if err := cfg.setChipSelect(opts.ChipSelect); nil != err {
+			return nil, err
+		}
+	}
+
+	switch opts.BitOrder {
+	case MSBFirst, LSBFirst:
+		cfg.bitOrder = opts.BitOrder
+	default:
+		return nil, fmt.Errorf("invalid bit order: %d", opts.BitOrder)
+	}
+
+	if err := opts.Timing.valid(); nil != err {
+		return nil, err
+	}
+	cfg.timing = opts.Timing
+	cfg.threeWire = opts.ThreeWire
+
+	switch opts.Ready {
+	case SPIReadyNone, SPIReadyHigh, SPIReadyLow:
+		cfg.ready = opts.Ready
+	default:
+		return nil, fmt.Errorf("invalid ready setting: %d", opts.Ready)
+	}
+
+	switch opts.Rounding {
+	case ClockNotFaster, ClockNearest:
+		cfg.rounding = opts.Rounding
+	default:
+		return nil, fmt.Errorf("invalid clock rounding: %d", opts.Rounding)
+	}
+
+	if err := cfg.check(spi.device.info); nil != err {
+		return nil, err
+	}
+
+	spi.devices = append(spi.devices, &cfg)
+
+	if ModeSPI == spi.device.mode {
+		if err := spi.deselectAll(); nil != err {
+			return nil, err
+		}
+	}
+
+	return &SPIDevice{bus: spi, config: &cfg}, nil
+}
+
+// ActualClock returns the SCLK rate (in Hertz, rounded down) that the MPSSE
+// generates for the clock rate of the peripheral.
+func (dev *SPIDevice) ActualClock() uint32 {
+	clk, err := dev.config.divisor(dev.bus.device.info)
+	if nil != err {
+		return 0
+	}
+	return uint32(clk.rate)
+}
+
+// Bus returns the SPI bus to which the peripheral is attached.
+func (dev *SPIDevice) Bus() *SPI {
+	return dev.bus
+}
+
+func (dev *SPIDevice) Write(data []uint8, start bool, stop bool) (uint32, error) {
+	n, err := dev.bus.xfer(dev.config, data, nil, 8*len(data), start, stop)
+	return n / 8, err
+}
+
+func (dev *SPIDevice) Read(data []uint8, start bool, stop bool) (uint32, error) {
+	n, err := dev.bus.xfer(dev.config, nil, data, 8*len(data), start, stop)
+	return n / 8, err
+}
+
+// Transfer simultaneously writes out and reads in (full-duplex). Both slices
+// must have the same length.
+func (dev *SPIDevice) Transfer(out []uint8, in []uint8, start bool, stop bool) (uint32, error) {
+	if len(out) != len(in) {
+		return 0, fmt.Errorf("transfer length mismatch: %d != %d", len(out), len(in))
+	}
+	n, err := dev.bus.xfer(dev.config, out, in, 8*len(out), start, stop)
+	return n / 8, err
+}
+
+// WaitReady waits at most timeout for the peripheral to signal ready. See
+// SPI.WaitReady.
+func (dev *SPIDevice) WaitReady(timeout time.Duration) error {
+	return dev.bus.waitReady(dev.config, timeout)
+}
+
+// Tx writes w and then reads r within a single frame. See SPI.Tx.
+func (dev *SPIDevice) Tx(w []uint8, r []uint8) error {
+	_, err := dev.bus.frame(dev.config, []spiPhase{
+		{w: w, nbits: 8 * len(w)},
+		{r: r, nbits: 8 * len(r)},
+	}, true, true)
+	return err
+}
+
+// SubmitTx queues a frame writing w and then reading r. See SPI.SubmitTx.
+func (dev *SPIDevice) SubmitTx(w []uint8, r []uint8) *SPIFuture {
+	return dev.bus.submit(dev.config, w, r)
+}
+
+// WriteBits writes the first nbits bits of data. See SPI.WriteBits for the bit
+// order and alignment of data.
+func (dev *SPIDevice) WriteBits(data []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	if nbits < 0 || (nbits+7)/8 > len(data) {
+		return 0, fmt.Errorf("invalid bit count: %d", nbits)
+	}
+	return dev.bus.xfer(dev.config, data, nil, nbits, start, stop)
+}
+
+// ReadBits reads nbits bits into data. See SPI.WriteBits for the bit order and
+// alignment of data.
+func (dev *SPIDevice) ReadBits(data []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	if nbits < 0 || (nbits+7)/8 > len(data) {
+		return 0, fmt.Errorf("invalid bit count: %d", nbits)
+	}
+	return dev.bus.xfer(dev.config, nil, data, nbits, start, stop)
+}
+
+// TransferBits simultaneously writes and reads nbits bits (full-duplex). See
+// SPI.WriteBits for the bit order and alignment of out and in.
+func (dev *SPIDevice) TransferBits(out []uint8, in []uint8, nbits int, start bool, stop bool) (uint32, error) {
+	if nbits < 0 || (nbits+7)/8 > len(out) || (nbits+7)/8 > len(in) {
+		return 0, fmt.Errorf("invalid bit count: %d", nbits)
+	}
+	return dev.bus.xfer(dev.config, out, in, nbits, start, stop)
+}
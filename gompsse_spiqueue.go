@@ -0,0 +1,280 @@
+package gompsse
+
+import (
+	"fmt"
+	"sync"
+)
+
+// spiQueueLimit is the number of bytes of commands that submitted transfers
+// coalesce into a single USB write, and of output they may have pending at
+// once. SubmitTx blocks until enough output has been read back.
+const spiQueueLimit = 4 * mpsseMaxXferBytes
+
+// spiQueue holds transfers submitted with SubmitTx. Their commands are
+// coalesced into a batch that is written to the device in a single USB write
+// once it reaches spiQueueLimit, whenever the output of all earlier writes has
+// been read back (so that the device is never left idle), or before any other
+// operation uses the device. The output is read back by a collector goroutine,
+// which completes each transfer in order, so that the caller can continue
+// working while the device is busy. The device lock is only held while
+// building and writing transfers; any other operation needing the device
+// first writes the batch and waits until all pending output has been read
+// back, so that it cannot be taken out of order.
+type spiQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond   // signaled whenever pending output is read back
+	batch   *mpsseCmd    // commands of transfers not yet written
+	queued  []*SPIFuture // transfers in batch
+	pending []*SPIFuture // transfers written, awaiting output
+	rx      int          // bytes of output pending or in batch
+	running bool         // collector goroutine running
+	err     error        // first error since last Flush
+}
+
+// init prepares the queue for use.
+func (q *spiQueue) init() {
+	q.cond = sync.NewCond(&q.mu)
+	q.batch = &mpsseCmd{}
+}
+
+// SPIFuture is the pending result of a transfer submitted with SubmitTx.
+type SPIFuture struct {
+	cfg   *spiConfig
+	phase []spiPhase
+	rx    int // bytes of output produced by the transfer
+	nbits int
+	done  chan struct{}
+	n     uint32
+	err   error
+}
+
+// Done returns true if the transfer has completed.
+func (f *SPIFuture) Done() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits for the transfer to complete, returning the total number of bytes
+// written and read by the transfer.
+func (f *SPIFuture) Wait() (uint32, error) {
+	<-f.done
+	return f.n, f.err
+}
+
+// complete records the result of the transfer.
+func (f *SPIFuture) complete(nbits int, err error) {
+	f.n, f.err = uint32(nbits/8), err
+	close(f.done)
+}
+
+// SubmitTx queues a frame writing w and then reading r, as for Tx, and returns
+// without waiting for it to complete. Frames are performed in the order they
+// are submitted, and are coalesced into USB writes of up to 256 KiB; the
+// returned SPIFuture completes once the output of its frame has been read back
+// in the background. r must not be accessed until the frame completes.
+// SubmitTx blocks while the output of earlier frames pending would exceed 256
+// KiB. A CS user function cannot be used with queued transfers.
+func (spi *SPI) SubmitTx(w []uint8, r []uint8) *SPIFuture {
+	return spi.submit(spi.config, w, r)
+}
+
+// Flush writes any queued transfers and waits for all transfers submitted with
+// SubmitTx to complete, returning the first error encountered since the last
+// call to Flush.
+func (spi *SPI) Flush() error {
+	q := &spi.queue
+	spi.device.lock()
+	spi.device.mu.Unlock()
+	q.mu.Lock()
+	err := q.err
+	q.err = nil
+	q.mu.Unlock()
+	return err
+}
+
+// drain writes any queued transfers and waits for the output of all submitted
+// transfers to be read back before another operation is performed on the
+// device. Errors are reported to the futures of the failed transfers. The
+// caller must hold the device lock.
+func (spi *SPI) drain() {
+	q := &spi.queue
+	spi.write()
+	q.mu.Lock()
+	for len(q.pending) > 0 {
+		q.cond.Wait()
+	}
+	q.mu.Unlock()
+}
+
+// submit builds a frame using SPI configuration cfg and adds it to the batch.
+func (spi *SPI) submit(cfg *spiConfig, w []uint8, r []uint8) *SPIFuture {
+
+	f := &SPIFuture{cfg: cfg, done: make(chan struct{}), phase: []spiPhase{
+		{w: w, nbits: 8 * len(w)},
+		{r: r, nbits: 8 * len(r)},
+	}}
+
+	if csCallback == cfg.cs.kind {
+		f.complete(0, fmt.Errorf("CS function not supported by queued transfers"))
+		return f
+	}
+
+	q := &spi.queue
+
+	spi.device.mu.Lock()
+	defer spi.device.mu.Unlock()
+
+	st := spi.state()
+	cmd := &mpsseCmd{}
+	nbits, err := spi.build(cfg, f.phase, true, true, cmd, &st)
+	if nil != err {
+		q.mu.Lock()
+		q.fail(f, err)
+		q.mu.Unlock()
+		return f
+	}
+	f.rx, f.nbits = cmd.rx, nbits
+
+	// a latency change applies to the USB transfers that follow it, so the
+	// batch built with the current latency is written first
+	if st.hw.latency != spi.hw.latency {
+		spi.write()
+		if err := spi.latency(&st); nil != err {
+			q.mu.Lock()
+			q.fail(f, err)
+			q.mu.Unlock()
+			return f
+		}
+	}
+
+	// write the batch if the transfer does not fit in it, and then wait for
+	// room for its output, always admitting one transfer if none is pending
+	q.mu.Lock()
+	full := len(q.batch.buf)+len(cmd.buf) > spiQueueLimit ||
+		q.rx+f.rx > spiQueueLimit
+	q.mu.Unlock()
+	if full {
+		spi.write()
+	}
+	q.mu.Lock()
+	for len(q.pending) > 0 && q.rx+f.rx > spiQueueLimit {
+		q.cond.Wait()
+	}
+	q.batch.append(cmd.buf...)
+	q.batch.rx += cmd.rx
+	q.queued = append(q.queued, f)
+	q.rx += f.rx
+	idle := 0 == len(q.pending)
+	q.mu.Unlock()
+	spi.commit(&st)
+
+	// nothing is being read back, so the device would otherwise be left idle
+	if idle {
+		spi.write()
+	}
+
+	return f
+}
+
+// write writes the batch of queued transfers to the device, starting the
+// collector if needed. The caller must hold the device lock.
+func (spi *SPI) write() {
+
+	q := &spi.queue
+
+	q.mu.Lock()
+	if 0 == len(q.queued) {
+		q.mu.Unlock()
+		return
+	}
+	cmd, queued := q.batch, q.queued
+	q.batch, q.queued = &mpsseCmd{}, nil
+	q.mu.Unlock()
+
+	if cmd.rx > 0 {
+		cmd.flush()
+	}
+	if err := spi.device.send(cmd); nil != err {
+		q.mu.Lock()
+		for _, f := range queued {
+			q.rx -= f.rx
+			q.fail(f, err)
+		}
+		q.mu.Unlock()
+		for _, f := range queued {
+			spi.deselectLocked(f.cfg)
+		}
+		return
+	}
+
+	q.mu.Lock()
+	q.pending = append(q.pending, queued...)
+	if !q.running {
+		q.running = true
+		go spi.collect()
+	}
+	q.mu.Unlock()
+}
+
+// flushIdle writes the batch of queued transfers once the output of all
+// earlier writes has been read back, unless another operation has already
+// written it.
+func (spi *SPI) flushIdle() {
+	spi.device.mu.Lock()
+	spi.write()
+	spi.device.mu.Unlock()
+}
+
+// fail completes f with err, recording err as the first error since the last
+// Flush if it is. The caller must hold q.mu.
+func (q *spiQueue) fail(f *SPIFuture, err error) {
+	f.complete(0, err)
+	if nil == q.err {
+		q.err = err
+	}
+}
+
+// collect reads the output of written transfers, in order, completing each
+// one, until none remain pending. If transfers were queued meanwhile, their
+// batch is then written so that the device does not sit idle.
+func (spi *SPI) collect() {
+
+	q := &spi.queue
+
+	for {
+		q.mu.Lock()
+		if 0 == len(q.pending) {
+			q.running = false
+			if len(q.queued) > 0 {
+				go spi.flushIdle()
+			}
+			q.mu.Unlock()
+			return
+		}
+		f := q.pending[0]
+		q.mu.Unlock()
+
+		in, err := spi.device.recv(f.rx)
+
+		q.mu.Lock()
+		if nil != err {
+			// output can no longer be matched to the remaining transfers
+			for _, g := range q.pending {
+				q.rx -= g.rx
+				q.fail(g, err)
+			}
+			q.pending = nil
+		} else {
+			f.cfg.unpack(f.phase, in)
+			f.complete(f.nbits, nil)
+			q.pending = q.pending[1:]
+			q.rx -= f.rx
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,158 @@
+package gompsse
+
+import "io"
+
+// Constants related to the size of each USB transfer made by an SPIStream.
+const (
+	// spiStreamChunk is the number of data bytes sent to the device per USB
+	// transfer, matching the limit of a single MPSSE data shifting opcode.
+	spiStreamChunk = mpsseMaxXferBytes
+
+	// spiStreamCmdLimit is the size of the command buffer built for each USB
+	// transfer, which the delays of SPITiming may reach well before the data
+	// reaches spiStreamChunk. It holds the longest delays around a word.
+	spiStreamCmdLimit = 4 * mpsseMaxXferBytes
+
+	// spiStreamFrameBytes bounds the commands framing each transfer other
+	// than its delays: CS writes and the data shifting opcodes of a word.
+	spiStreamFrameBytes = 32
+)
+
+// SPIStream is an io.Writer, io.Reader and io.ReaderFrom view of an SPI
+// peripheral for transferring large amounts of data, such as framebuffers or
+// firmware images. CS is asserted by the first non-empty Write or Read and is
+// held asserted across all subsequent calls until Close.
+type SPIStream struct {
+	bus    *SPI
+	config *spiConfig
+	active bool // CS asserted
+}
+
+// Compile-time verification of the implemented io interfaces.
+var (
+	_ io.Writer     = (*SPIStream)(nil)
+	_ io.Reader     = (*SPIStream)(nil)
+	_ io.ReaderFrom = (*SPIStream)(nil)
+	_ io.Closer     = (*SPIStream)(nil)
+)
+
+// Stream returns an SPIStream using the SPI bus configuration.
+func (spi *SPI) Stream() *SPIStream {
+	return &SPIStream{bus: spi, config: spi.config}
+}
+
+// Stream returns an SPIStream using the peripheral's configuration.
+func (dev *SPIDevice) Stream() *SPIStream {
+	return &SPIStream{bus: dev.bus, config: dev.config}
+}
+
+// Write writes all of p, in chunks of at most 64 KiB (fewer if SPITiming adds
+// a delay between words, to bound the command buffer). If an error occurs, the
+// number of bytes written by the chunks that completed is returned, and CS is
+// deasserted.
+func (s *SPIStream) Write(p []byte) (int, error) {
+	return s.stream(p, nil)
+}
+
+// Read reads len(p) bytes into p, in chunks as for Write. No data is
+// written on MOSI while reading. If an error occurs, the number of bytes read
+// by the chunks that completed is returned, and CS is deasserted.
+func (s *SPIStream) Read(p []byte) (int, error) {
+	return s.stream(nil, p)
+}
+
+// ReadFrom writes all data read from r until io.EOF, returning the number of
+// bytes written.
+func (s *SPIStream) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	buf := make([]byte, spiStreamChunk)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			m, werr := s.Write(buf[:n])
+			total += int64(m)
+			if nil != werr {
+				return total, werr
+			}
+		}
+		if io.EOF == rerr {
+			return total, nil
+		}
+		if nil != rerr {
+			return total, rerr
+		}
+	}
+}
+
+// Close deasserts CS, ending the stream. The SPIStream may be reused after
+// Close, with CS asserted again by the next Write or Read.
+func (s *SPIStream) Close() error {
+	if !s.active {
+		return nil
+	}
+	s.active = false
+	_, err := s.bus.xfer(s.config, nil, nil, 0, false, true)
+	return err
+}
+
+// stream transfers w or r in chunks of at most s.config.streamChunk() bytes,
+// asserting CS before the first chunk if not already asserted.
+func (s *SPIStream) stream(w []byte, r []byte) (int, error) {
+
+	size := len(w) + len(r) // only one of w or r is non-nil
+	chunk := s.config.streamChunk()
+	done := 0
+
+	for done < size {
+		end := done + chunk
+		if end > size {
+			end = size
+		}
+		var wc, rc []byte
+		if nil != w {
+			wc = w[done:end]
+		}
+		if nil != r {
+			rc = r[done:end]
+		}
+		n, err := s.bus.xfer(s.config, wc, rc, 8*(end-done), !s.active, false)
+		if nil != err {
+			s.active = false // xfer deasserts CS on error
+			return done, err
+		}
+		s.active = true
+		done += int(n / 8)
+	}
+
+	return done, nil
+}
+
+// streamChunk returns the number of data bytes an SPIStream transfers with cfg
+// per USB transfer: a whole number of words whose commands, including the
+// delays of cfg.timing, fit within spiStreamCmdLimit. A single word is always
+// allowed, as SPITiming bounds each delay.
+func (cfg *spiConfig) streamChunk() int {
+
+	if 0 == cfg.timing.WordDelay {
+		return spiStreamChunk
+	}
+
+	size := 1
+	if cfg.timing.WordSize > 0 {
+		size = cfg.timing.WordSize
+	}
+
+	t := cfg.timing
+	frame := 3*(delayCount(t.CSSetup)+delayCount(t.CSHold)+delayCount(t.CSIdle)) +
+		spiStreamFrameBytes
+	word := size + 3 + 3*delayCount(t.WordDelay) // data, opcode, delay
+
+	words := (spiStreamCmdLimit - frame) / word
+	if max := spiStreamChunk / size; words > max {
+		words = max
+	}
+	if words < 1 {
+		words = 1
+	}
+	return words * size
+}
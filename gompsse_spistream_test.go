@@ -0,0 +1,51 @@
+package gompsse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSPIStreamChunk(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		timing SPITiming
+		want   int // expected chunk size, 0 to only check the command size
+	}{
+		{"no delay", SPITiming{}, spiStreamChunk},
+		{"cs delays only", SPITiming{CSSetup: mpsseMaxDelay, CSHold: mpsseMaxDelay}, spiStreamChunk},
+		{"short word delay", SPITiming{WordDelay: 100 * time.Nanosecond}, 0},
+		{"long word delay", SPITiming{WordDelay: mpsseMaxDelay}, 0},
+		{"all delays", SPITiming{CSSetup: mpsseMaxDelay, CSHold: mpsseMaxDelay,
+			CSIdle: mpsseMaxDelay, WordDelay: mpsseMaxDelay, WordSize: 3}, 3},
+		{"large words", SPITiming{WordDelay: time.Microsecond, WordSize: 3 * mpsseMaxXferBytes},
+			3 * mpsseMaxXferBytes},
+	}
+
+	for _, tt := range tests {
+		cfg := &spiConfig{timing: tt.timing}
+		n := cfg.streamChunk()
+		if 0 != tt.want && n != tt.want {
+			t.Errorf("%s: got chunk %d, want %d", tt.name, n, tt.want)
+			continue
+		}
+		size := 1
+		if tt.timing.WordSize > 0 {
+			size = tt.timing.WordSize
+		}
+		if n < size || 0 != n%size {
+			t.Errorf("%s: chunk %d not a whole number of %d-byte words", tt.name, n, size)
+			continue
+		}
+		if tt.timing.WordDelay > 0 && size <= spiStreamChunk {
+			cmd := &mpsseCmd{}
+			cfg.shift(cmd, &spiState{}, spiClocking{}, make([]uint8, n), nil, 8*n)
+			cs := 3 * (delayCount(tt.timing.CSSetup) + delayCount(tt.timing.CSHold) +
+				delayCount(tt.timing.CSIdle))
+			if len(cmd.buf)+cs > spiStreamCmdLimit {
+				t.Errorf("%s: chunk %d builds %d bytes of commands, limit %d",
+					tt.name, n, len(cmd.buf)+cs, spiStreamCmdLimit)
+			}
+		}
+	}
+}
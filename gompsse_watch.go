@@ -0,0 +1,216 @@
+package gompsse
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Edge selects the pin transitions reported by WatchPin.
+type Edge uint8
+
+// Constants defining the pin transitions.
+const (
+	EdgeRising  Edge = 1 << iota // LOW to HIGH
+	EdgeFalling                  // HIGH to LOW
+	EdgeBoth    = EdgeRising | EdgeFalling
+)
+
+func (e Edge) String() string {
+	switch e {
+	case EdgeRising:
+		return "Rising"
+	case EdgeFalling:
+		return "Falling"
+	case EdgeBoth:
+		return "Both"
+	default:
+		return "Unknown"
+	}
+}
+
+// Constants defining the default WatchOptions.
+const (
+	watchPollDefault     = 10 * time.Millisecond
+	watchSamplesDefault  = 4
+	watchDebounceDefault = 0
+	watchBufferSize      = 16 // events buffered before sampling blocks
+)
+
+// WatchOptions configures the sampling performed by WatchPin. The pin is
+// sampled Samples times every Poll interval, spread evenly across it by the
+// host. Each sample is a separate 2-byte USB transfer, so the device is only
+// locked briefly and other operations interleave with sampling, but each costs
+// a USB round trip (at least 125 us on Hi-Speed devices, 1 ms on Full-Speed),
+// which bounds how closely samples can actually be spaced. A new level is
+// reported only once every sample has read that level for at least Debounce,
+// so that bouncing contacts produce a single event.
+type WatchOptions struct {
+	Poll     time.Duration // interval over which Samples samples are taken
+	Samples  int           // samples per Poll interval
+	Debounce time.Duration // minimum time a new level must be stable
+}
+
+// watchOptionsDefault returns the WatchOptions used until SetWatchOptions.
+func watchOptionsDefault() WatchOptions {
+	return WatchOptions{
+		Poll:     watchPollDefault,
+		Samples:  watchSamplesDefault,
+		Debounce: watchDebounceDefault,
+	}
+}
+
+// PinEvent is a transition of a watched pin.
+type PinEvent struct {
+	Pin   Pin
+	Edge  Edge      // EdgeRising or EdgeFalling
+	Level bool      // level after the transition
+	Time  time.Time // when the new level was first sampled
+}
+
+// PinWatch reports the transitions of a pin on its channel C until stopped.
+type PinWatch struct {
+	C    <-chan PinEvent
+	stop chan struct{}
+	once sync.Once // closes stop
+	done chan struct{}
+	err  error
+}
+
+// Stop stops sampling the pin and closes C, returning the error that stopped
+// sampling early, if any.
+func (w *PinWatch) Stop() error {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+	return w.err
+}
+
+// Err returns the error that stopped sampling, if any, once C is closed.
+func (w *PinWatch) Err() error {
+	select {
+	case <-w.done:
+		return w.err
+	default:
+		return nil
+	}
+}
+
+// SetWatchOptions sets the WatchOptions used by subsequent calls to WatchPin.
+// Zero values select the defaults.
+func (gpio *GPIO) SetWatchOptions(opts WatchOptions) error {
+	if opts.Poll < 0 || opts.Samples < 0 || opts.Debounce < 0 {
+		return fmt.Errorf("invalid watch options: %+v", opts)
+	}
+	def := watchOptionsDefault()
+	if 0 == opts.Poll {
+		opts.Poll = def.Poll
+	}
+	if 0 == opts.Samples {
+		opts.Samples = def.Samples
+	}
+	gpio.watch = opts
+	return nil
+}
+
+// WatchPin begins sampling the given MPSSE pin (as returned by MPSSE.Pin) in a
+// background goroutine, reporting each transition selected by edge on the
+// returned PinWatch's channel. The pin should be configured as an input. The
+// goroutine shares the device with all other operations, which remain safe to
+// perform from the calling goroutine.
+func (gpio *GPIO) WatchPin(pin Pin, edge Edge) (*PinWatch, error) {
+
+	var (
+		mask uint8
+		high bool
+	)
+
+	switch p := pin.(type) {
+	case *cPin:
+		mask, high = uint8(p.pin), true
+	case *dPin:
+		if res := gpio.device.reservedLow() & uint8(p.pin); 0 != res {
+			return nil, fmt.Errorf("pins in use by %s: 0x%02X", gpio.device.mode, res)
+		}
+		mask = uint8(p.pin)
+	default:
+		return nil, fmt.Errorf("pin not on MPSSE: %s", pin.Name())
+	}
+
+	if 0 == edge&EdgeBoth {
+		return nil, fmt.Errorf("invalid edge: %d", edge)
+	}
+
+	ch := make(chan PinEvent, watchBufferSize)
+	w := &PinWatch{C: ch, stop: make(chan struct{}), done: make(chan struct{})}
+	go w.run(gpio.device, pin, mask, high, edge, gpio.watch, ch)
+
+	return w, nil
+}
+
+// run samples the pin until stopped or an error occurs, sending events to ch.
+func (w *PinWatch) run(m *MPSSE, pin Pin, mask uint8, high bool, edge Edge, opt WatchOptions, ch chan<- PinEvent) {
+
+	defer close(w.done)
+	defer close(ch)
+
+	tick := time.NewTicker(opt.Poll / time.Duration(opt.Samples))
+	defer tick.Stop()
+
+	var (
+		stable  bool      // debounced level
+		primed  bool      // stable level is known
+		next    bool      // new level awaiting debounce
+		pending bool      // next is valid
+		since   time.Time // when next was first sampled
+	)
+
+	for {
+		cmd := &mpsseCmd{}
+		if high {
+			cmd.getHigh()
+		} else {
+			cmd.getLow()
+		}
+		in, err := m.exec(cmd)
+		now := time.Now()
+		if nil != err {
+			w.err = err
+			return
+		}
+		level := 0 != in[0]&mask
+
+		switch {
+		case !primed:
+			stable, primed = level, true
+
+		case level == stable:
+			pending = false
+
+		default:
+			if !pending || next != level {
+				next, pending, since = level, true, now
+			}
+			if now.Sub(since) < opt.Debounce {
+				break
+			}
+			stable, pending = level, false
+			ev := PinEvent{Pin: pin, Edge: EdgeFalling, Level: level, Time: since}
+			if level {
+				ev.Edge = EdgeRising
+			}
+			if 0 != ev.Edge&edge {
+				select {
+				case ch <- ev:
+				case <-w.stop:
+					return
+				}
+			}
+		}
+
+		select {
+		case <-tick.C:
+		case <-w.stop:
+			return
+		}
+	}
+}
@@ -266,18 +266,116 @@ func _SPI_InitChannel(spi *SPI) error {
 	return nil
 }
 
-func _SPI_ChangeCS(spi *SPI, opt spiOption) error {
-	stat := Status(C.SPI_ChangeCS(C.PVOID(spi.device.info.handle), C.uint32(opt)))
+func _FT_Write(m *MPSSE, data []uint8) (uint32, error) {
+	if 0 == len(data) {
+		return 0, nil
+	}
+	var sent C.DWORD
+	stat := Status(C.FT_Write(C.PVOID(m.info.handle),
+		C.LPVOID(&data[0]), C.DWORD(len(data)), &sent))
+	if !stat.OK() {
+		return uint32(sent), stat
+	}
+	return uint32(sent), nil
+}
+
+func _FT_Read(m *MPSSE, data []uint8) (uint32, error) {
+	if 0 == len(data) {
+		return 0, nil
+	}
+	var recv C.DWORD
+	stat := Status(C.FT_Read(C.PVOID(m.info.handle),
+		C.LPVOID(&data[0]), C.DWORD(len(data)), &recv))
+	if !stat.OK() {
+		return uint32(recv), stat
+	}
+	return uint32(recv), nil
+}
+
+func _FT_GetQueueStatus(m *MPSSE) (uint32, error) {
+	var n C.DWORD
+	stat := Status(C.FT_GetQueueStatus(C.PVOID(m.info.handle), &n))
+	if !stat.OK() {
+		return 0, stat
+	}
+	return uint32(n), nil
+}
+
+func _FT_Purge(m *MPSSE) error {
+	stat := Status(C.FT_Purge(C.PVOID(m.info.handle), C.FT_PURGE_RX|C.FT_PURGE_TX))
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+func _FT_SetLatencyTimer(m *MPSSE, latency uint8) error {
+	stat := Status(C.FT_SetLatencyTimer(C.PVOID(m.info.handle), C.UCHAR(latency)))
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+func _FT_SetBitMode(m *MPSSE, mask uint8, mode uint8) error {
+	stat := Status(C.FT_SetBitMode(C.PVOID(m.info.handle), C.UCHAR(mask), C.UCHAR(mode)))
 	if !stat.OK() {
 		return stat
 	}
 	return nil
 }
 
-func _SPI_Write(spi *SPI, data []uint8, opt spiXferOption) (uint32, error) {
+func _I2C_InitChannel(i2c *I2C) error {
+
+	// close any open channels before trying to init
+	if err := i2c.device.Close(); nil != err {
+		return err
+	}
+
+	stat := Status(C.I2C_OpenChannel(C.uint32(i2c.device.info.index),
+		(*C.PVOID)(&i2c.device.info.handle)))
+	if !stat.OK() {
+		return stat
+	}
+
+	config := C.I2C_ChannelConfig{
+		ClockRate:    C.I2C_CLOCKRATE(i2c.config.clockRate),
+		LatencyTimer: C.uint8(i2c.config.latency),
+		Options:      C.uint32(i2c.config.options),
+	}
+
+	stat = Status(C.I2C_InitChannel(C.PVOID(i2c.device.info.handle), &config))
+	if !stat.OK() {
+		return stat
+	}
+
+	return nil
+}
+
+func _I2C_DeviceRead(i2c *I2C, addr uint8, data []uint8, opt uint32) (uint32, error) {
+	var recv C.uint32
+	buf := data
+	if 0 == len(buf) {
+		buf = []uint8{0} // libMPSSE rejects NULL buffers, even for 0 bytes
+	}
+	stat := Status(C.I2C_DeviceRead(C.PVOID(i2c.device.info.handle),
+		C.uint32(addr), C.uint32(len(data)), (*C.uint8)(&buf[0]), &recv,
+		C.uint32(opt)))
+	if !stat.OK() {
+		return uint32(recv), stat
+	}
+	return uint32(recv), nil
+}
+
+func _I2C_DeviceWrite(i2c *I2C, addr uint8, data []uint8, opt uint32) (uint32, error) {
 	var sent C.uint32
-	stat := Status(C.SPI_Write(C.PVOID(spi.device.info.handle),
-		(*C.uint8)(&data[0]), C.uint32(len(data)), &sent, C.uint32(opt)))
+	buf := data
+	if 0 == len(buf) {
+		buf = []uint8{0} // libMPSSE rejects NULL buffers, even for 0 bytes
+	}
+	stat := Status(C.I2C_DeviceWrite(C.PVOID(i2c.device.info.handle),
+		C.uint32(addr), C.uint32(len(data)), (*C.uint8)(&buf[0]), &sent,
+		C.uint32(opt)))
 	if !stat.OK() {
 		return uint32(sent), stat
 	}
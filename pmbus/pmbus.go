@@ -0,0 +1,194 @@
+// Package pmbus implements a PMBus client for power supplies and regulators
+// connected to the I2C bus of an MPSSE device.
+package pmbus
+
+import (
+	"fmt"
+	"strings"
+
+	mpsse "github.com/ardnew/gompsse"
+)
+
+// Device represents a single PMBus device on an I2C bus.
+type Device struct {
+	bus      *mpsse.SMBus
+	direct   map[Command]Coefficients
+	voutMode *uint8 // cached VOUT_MODE of the currently selected page
+}
+
+// New returns a PMBus client for the device with the given 7-bit address on
+// the I2C bus i2c, with SMBus Packet Error Checking enabled if pec is true.
+func New(i2c *mpsse.I2C, addr uint8, pec bool) *Device {
+	return &Device{
+		bus:      i2c.SMBus(addr, pec),
+		direct:   map[Command]Coefficients{},
+		voutMode: nil,
+	}
+}
+
+func (d *Device) String() string {
+	return fmt.Sprintf("{ Bus: %s, Direct: %+v }", d.bus, d.direct)
+}
+
+// SMBus returns the underlying SMBus handler, for issuing manufacturer-specific
+// commands.
+func (d *Device) SMBus() *mpsse.SMBus {
+	return d.bus
+}
+
+// SetDirect registers the DIRECT format coefficients used to decode cmd. Once
+// registered, cmd is decoded using DIRECT format instead of LINEAR11 (or, for
+// output voltage commands, whenever VOUT_MODE selects DIRECT format).
+func (d *Device) SetDirect(cmd Command, c Coefficients) {
+	d.direct[cmd] = c
+}
+
+// SetPage selects the page (output rail) addressed by all subsequent commands.
+func (d *Device) SetPage(page uint8) error {
+	d.voutMode = nil // VOUT_MODE may differ per page
+	return d.bus.WriteByteData(uint8(CmdPage), page)
+}
+
+func (d *Device) ClearFaults() error {
+	return d.bus.SendByte(uint8(CmdClearFaults))
+}
+
+// VoutMode returns the VOUT_MODE byte of the current page, reading it from the
+// device only the first time it is needed.
+func (d *Device) VoutMode() (uint8, error) {
+	if nil == d.voutMode {
+		mode, err := d.bus.ReadByteData(uint8(CmdVoutMode))
+		if nil != err {
+			return 0, err
+		}
+		d.voutMode = &mode
+	}
+	return *d.voutMode, nil
+}
+
+// Read reads and decodes the numeric command cmd, returning its value in the
+// unit defined for that command by the PMBus specification. Output voltage
+// commands are decoded according to VOUT_MODE, for which only the LINEAR16 and
+// DIRECT formats are supported; an error is returned if VOUT_MODE selects the
+// VID or IEEE half-precision format.
+func (d *Device) Read(cmd Command) (Value, error) {
+
+	info, ok := cmdTable[cmd]
+	if !ok {
+		return Value{}, fmt.Errorf("unsupported PMBus command: 0x%02X", uint8(cmd))
+	}
+
+	raw, err := d.bus.ReadWordData(uint8(cmd))
+	if nil != err {
+		return Value{}, err
+	}
+
+	val, err := d.decode(cmd, info, raw)
+	if nil != err {
+		return Value{}, err
+	}
+
+	return Value{Value: val, Unit: info.unit}, nil
+}
+
+func (d *Device) Vin() (Value, error)  { return d.Read(CmdReadVin) }
+func (d *Device) Iin() (Value, error)  { return d.Read(CmdReadIin) }
+func (d *Device) Pin() (Value, error)  { return d.Read(CmdReadPin) }
+func (d *Device) Vout() (Value, error) { return d.Read(CmdReadVout) }
+func (d *Device) Iout() (Value, error) { return d.Read(CmdReadIout) }
+func (d *Device) Pout() (Value, error) { return d.Read(CmdReadPout) }
+
+// Temperature reads temperature sensor n (1, 2, or 3).
+func (d *Device) Temperature(n int) (Value, error) {
+	switch n {
+	case 1:
+		return d.Read(CmdReadTemperature1)
+	case 2:
+		return d.Read(CmdReadTemperature2)
+	case 3:
+		return d.Read(CmdReadTemperature3)
+	default:
+		return Value{}, fmt.Errorf("invalid temperature sensor: %d", n)
+	}
+}
+
+// ReadString reads a block command containing ASCII text (e.g., MFR_ID).
+func (d *Device) ReadString(cmd Command) (string, error) {
+	b, err := d.bus.ReadBlockData(uint8(cmd))
+	if nil != err {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\x00 "), nil
+}
+
+func (d *Device) StatusWord() (Status, error) {
+	w, err := d.bus.ReadWordData(uint8(CmdStatusWord))
+	if nil != err {
+		return 0, err
+	}
+	return Status(w), nil
+}
+
+// Faults reads STATUS_WORD and, for each summary bit that is set, the detailed
+// status register it summarizes, returning a description of every fault and
+// warning reported by the device.
+func (d *Device) Faults() ([]string, error) {
+
+	stat, err := d.StatusWord()
+	if nil != err {
+		return nil, err
+	}
+
+	var faults []string
+	for _, det := range statusDetails {
+		if 0 == stat&det.summary {
+			continue
+		}
+		reg, err := d.bus.ReadByteData(uint8(det.cmd))
+		if nil != err {
+			return nil, err
+		}
+		for i, name := range det.bits {
+			if 0 != reg&(1<<uint(i)) && "" != name {
+				faults = append(faults, name)
+			}
+		}
+		stat &= ^det.summary // described in detail, omit summary
+	}
+
+	return append(stat.Faults(), faults...), nil
+}
+
+// decode converts the raw data word of cmd to a real-world value according to
+// the data format of cmd.
+func (d *Device) decode(cmd Command, info cmdInfo, raw uint16) (float64, error) {
+
+	coef, isDirect := d.direct[cmd]
+
+	if !info.vout {
+		if isDirect {
+			return Direct(raw, coef), nil
+		}
+		return Linear11(raw), nil
+	}
+
+	mode, err := d.VoutMode()
+	if nil != err {
+		return 0, err
+	}
+
+	switch mode & voutModeMask {
+	case voutModeLinear:
+		if info.signed {
+			return Linear16Signed(raw, mode), nil
+		}
+		return Linear16(raw, mode), nil
+	case voutModeDirect:
+		if !isDirect {
+			return 0, fmt.Errorf("no DIRECT coefficients for command 0x%02X", uint8(cmd))
+		}
+		return Direct(raw, coef), nil
+	default:
+		return 0, fmt.Errorf("unsupported VOUT_MODE: 0x%02X", mode)
+	}
+}
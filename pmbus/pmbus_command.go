@@ -0,0 +1,128 @@
+package pmbus
+
+// Command identifies a PMBus command code.
+type Command uint8
+
+// Constants defining the standard PMBus command codes (PMBus Part II, rev 1.2).
+const (
+	CmdPage               Command = 0x00
+	CmdOperation          Command = 0x01
+	CmdOnOffConfig        Command = 0x02
+	CmdClearFaults        Command = 0x03
+	CmdPhase              Command = 0x04
+	CmdWriteProtect       Command = 0x10
+	CmdStoreDefaultAll    Command = 0x11
+	CmdRestoreDefaultAll  Command = 0x12
+	CmdCapability         Command = 0x19
+	CmdQuery              Command = 0x1A
+	CmdVoutMode           Command = 0x20
+	CmdVoutCommand        Command = 0x21
+	CmdVoutTrim           Command = 0x22
+	CmdVoutCalOffset      Command = 0x23
+	CmdVoutMax            Command = 0x24
+	CmdVoutMarginHigh     Command = 0x25
+	CmdVoutMarginLow      Command = 0x26
+	CmdVoutTransitionRate Command = 0x27
+	CmdVoutDroop          Command = 0x28
+	CmdVoutScaleLoop      Command = 0x29
+	CmdVoutScaleMonitor   Command = 0x2A
+	CmdCoefficients       Command = 0x30
+	CmdPoutMax            Command = 0x31
+	CmdFrequencySwitch    Command = 0x33
+	CmdVinOn              Command = 0x35
+	CmdVinOff             Command = 0x36
+	CmdIoutCalGain        Command = 0x38
+	CmdIoutCalOffset      Command = 0x39
+	CmdVoutOVFaultLimit   Command = 0x40
+	CmdVoutOVWarnLimit    Command = 0x42
+	CmdVoutUVWarnLimit    Command = 0x43
+	CmdVoutUVFaultLimit   Command = 0x44
+	CmdIoutOCFaultLimit   Command = 0x46
+	CmdIoutOCWarnLimit    Command = 0x4A
+	CmdOTFaultLimit       Command = 0x4F
+	CmdOTWarnLimit        Command = 0x51
+	CmdVinOVFaultLimit    Command = 0x55
+	CmdVinOVWarnLimit     Command = 0x57
+	CmdVinUVWarnLimit     Command = 0x58
+	CmdVinUVFaultLimit    Command = 0x59
+	CmdStatusByte         Command = 0x78
+	CmdStatusWord         Command = 0x79
+	CmdStatusVout         Command = 0x7A
+	CmdStatusIout         Command = 0x7B
+	CmdStatusInput        Command = 0x7C
+	CmdStatusTemperature  Command = 0x7D
+	CmdStatusCML          Command = 0x7E
+	CmdStatusOther        Command = 0x7F
+	CmdStatusMfrSpecific  Command = 0x80
+	CmdStatusFans12       Command = 0x81
+	CmdReadVin            Command = 0x88
+	CmdReadIin            Command = 0x89
+	CmdReadVcap           Command = 0x8A
+	CmdReadVout           Command = 0x8B
+	CmdReadIout           Command = 0x8C
+	CmdReadTemperature1   Command = 0x8D
+	CmdReadTemperature2   Command = 0x8E
+	CmdReadTemperature3   Command = 0x8F
+	CmdReadFanSpeed1      Command = 0x90
+	CmdReadFanSpeed2      Command = 0x91
+	CmdReadDutyCycle      Command = 0x94
+	CmdReadFrequency      Command = 0x95
+	CmdReadPout           Command = 0x96
+	CmdReadPin            Command = 0x97
+	CmdRevision           Command = 0x98
+	CmdMfrID              Command = 0x99
+	CmdMfrModel           Command = 0x9A
+	CmdMfrRevision        Command = 0x9B
+	CmdMfrLocation        Command = 0x9C
+	CmdMfrDate            Command = 0x9D
+	CmdMfrSerial          Command = 0x9E
+)
+
+// cmdInfo describes how the data word of a numeric command is interpreted.
+type cmdInfo struct {
+	unit   Unit
+	vout   bool // format given by VOUT_MODE (else LINEAR11 or DIRECT)
+	signed bool // LINEAR16 mantissa is two's complement
+}
+
+// cmdTable defines the interpretation of each numeric command supported by
+// Device.Read.
+var cmdTable = map[Command]cmdInfo{
+	CmdVoutCommand:        {unit: Volt, vout: true},
+	CmdVoutTrim:           {unit: Volt, vout: true, signed: true},
+	CmdVoutCalOffset:      {unit: Volt, vout: true, signed: true},
+	CmdVoutMax:            {unit: Volt, vout: true},
+	CmdVoutMarginHigh:     {unit: Volt, vout: true},
+	CmdVoutMarginLow:      {unit: Volt, vout: true},
+	CmdVoutOVFaultLimit:   {unit: Volt, vout: true},
+	CmdVoutOVWarnLimit:    {unit: Volt, vout: true},
+	CmdVoutUVWarnLimit:    {unit: Volt, vout: true},
+	CmdVoutUVFaultLimit:   {unit: Volt, vout: true},
+	CmdReadVout:           {unit: Volt, vout: true},
+	CmdVoutTransitionRate: {unit: VoltPerMillisecond},
+	CmdPoutMax:            {unit: Watt},
+	CmdFrequencySwitch:    {unit: Kilohertz},
+	CmdVinOn:              {unit: Volt},
+	CmdVinOff:             {unit: Volt},
+	CmdIoutOCFaultLimit:   {unit: Ampere},
+	CmdIoutOCWarnLimit:    {unit: Ampere},
+	CmdOTFaultLimit:       {unit: Celsius},
+	CmdOTWarnLimit:        {unit: Celsius},
+	CmdVinOVFaultLimit:    {unit: Volt},
+	CmdVinOVWarnLimit:     {unit: Volt},
+	CmdVinUVWarnLimit:     {unit: Volt},
+	CmdVinUVFaultLimit:    {unit: Volt},
+	CmdReadVin:            {unit: Volt},
+	CmdReadIin:            {unit: Ampere},
+	CmdReadVcap:           {unit: Volt},
+	CmdReadIout:           {unit: Ampere},
+	CmdReadTemperature1:   {unit: Celsius},
+	CmdReadTemperature2:   {unit: Celsius},
+	CmdReadTemperature3:   {unit: Celsius},
+	CmdReadFanSpeed1:      {unit: RPM},
+	CmdReadFanSpeed2:      {unit: RPM},
+	CmdReadDutyCycle:      {unit: Percent},
+	CmdReadFrequency:      {unit: Kilohertz},
+	CmdReadPout:           {unit: Watt},
+	CmdReadPin:            {unit: Watt},
+}
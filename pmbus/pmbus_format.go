@@ -0,0 +1,90 @@
+package pmbus
+
+import (
+	"fmt"
+	"math"
+)
+
+// Unit identifies the physical unit of a decoded PMBus value.
+type Unit string
+
+// Constants defining the units used by standard PMBus commands.
+const (
+	Volt               Unit = "V"
+	Ampere             Unit = "A"
+	Watt               Unit = "W"
+	Celsius            Unit = "°C"
+	RPM                Unit = "RPM"
+	Percent            Unit = "%"
+	Kilohertz          Unit = "kHz"
+	VoltPerMillisecond Unit = "mV/ms"
+)
+
+// Value holds a decoded PMBus reading and its unit.
+type Value struct {
+	Value float64
+	Unit  Unit
+}
+
+func (v Value) String() string {
+	return fmt.Sprintf("%g %s", v.Value, v.Unit)
+}
+
+// Constants related to the VOUT_MODE data byte.
+const (
+	voutModeMask     = 0xE0
+	voutModeLinear   = 0x00
+	voutModeVID      = 0x20
+	voutModeDirect   = 0x40
+	voutModeIEEEHalf = 0x60
+	voutModeExpMask  = 0x1F
+)
+
+// Coefficients holds the DIRECT format coefficients m, b, and R of a command,
+// as given in the device datasheet or reported by the COEFFICIENTS command.
+type Coefficients struct {
+	M int16
+	B int16
+	R int8
+}
+
+// signExtend interprets the low n bits of v as an n-bit two's complement value.
+func signExtend(v uint16, n uint) int {
+	shift := 16 - n
+	return int(int16(v<<shift) >> shift)
+}
+
+// Linear11 decodes a LINEAR11 data word, consisting of a 5-bit two's complement
+// exponent (bits 15:11) and an 11-bit two's complement mantissa (bits 10:0).
+func Linear11(raw uint16) float64 {
+	exp := signExtend(raw>>11, 5)
+	man := signExtend(raw&0x07FF, 11)
+	return math.Ldexp(float64(man), exp)
+}
+
+// Linear16 decodes a LINEAR16 data word, an unsigned 16-bit mantissa whose
+// 5-bit two's complement exponent is taken from the VOUT_MODE byte mode. Only
+// the exponent of mode is used; VID and IEEE half-precision VOUT_MODE formats
+// are not supported and must not be decoded with Linear16.
+func Linear16(raw uint16, mode uint8) float64 {
+	exp := signExtend(uint16(mode&voutModeExpMask), 5)
+	return math.Ldexp(float64(raw), exp)
+}
+
+// Linear16Signed decodes a LINEAR16 data word like Linear16, but with a 16-bit
+// two's complement mantissa, as used by the commands holding an offset from the
+// output voltage (VOUT_TRIM and VOUT_CAL_OFFSET).
+func Linear16Signed(raw uint16, mode uint8) float64 {
+	exp := signExtend(uint16(mode&voutModeExpMask), 5)
+	return math.Ldexp(float64(int16(raw)), exp)
+}
+
+// Direct decodes a DIRECT format data word, a 16-bit two's complement value Y,
+// to X = (Y·10^-R - b) / m.
+func Direct(raw uint16, c Coefficients) float64 {
+	if 0 == c.M {
+		return math.NaN()
+	}
+	y := float64(int16(raw))
+	return (y*math.Pow10(-int(c.R)) - float64(c.B)) / float64(c.M)
+}
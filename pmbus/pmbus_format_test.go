@@ -0,0 +1,85 @@
+package pmbus
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLinear11(t *testing.T) {
+
+	tests := []struct {
+		raw  uint16
+		want float64
+	}{
+		{0x0000, 0},
+		{0xF803, 1.5},         // exp -1, man 3
+		{0x07FF, -1},          // exp 0, man -1
+		{0xF3FF, 255.75},      // exp -2, man 1023
+		{0xF400, -256},        // exp -2, man -1024
+		{0x7801, 32768},       // exp 15, man 1
+		{0x8001, 1.0 / 65536}, // exp -16, man 1
+	}
+
+	for _, tt := range tests {
+		if got := Linear11(tt.raw); got != tt.want {
+			t.Errorf("Linear11(0x%04X): got %g, want %g", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestLinear16(t *testing.T) {
+
+	tests := []struct {
+		raw    uint16
+		mode   uint8
+		want   float64
+		signed float64
+	}{
+		{0x0600, 0x17, 3.0, 3.0},          // exp -9
+		{0xFF00, 0x17, 127.5, -0.5},       // exp -9
+		{0xFFFF, 0x00, 65535, -1},         // exp 0
+		{0x0001, 0x0F, 32768, 32768},      // exp 15
+		{0x8000, 0x1F, 16384, -16384},     // exp -1
+		{0x0400, 0x14 | 0x80, 0.25, 0.25}, // only the exponent of mode is used
+	}
+
+	for _, tt := range tests {
+		if got := Linear16(tt.raw, tt.mode); got != tt.want {
+			t.Errorf("Linear16(0x%04X, 0x%02X): got %g, want %g",
+				tt.raw, tt.mode, got, tt.want)
+		}
+		if got := Linear16Signed(tt.raw, tt.mode); got != tt.signed {
+			t.Errorf("Linear16Signed(0x%04X, 0x%02X): got %g, want %g",
+				tt.raw, tt.mode, got, tt.signed)
+		}
+	}
+}
+
+func TestDirect(t *testing.T) {
+
+	tests := []struct {
+		raw  uint16
+		c    Coefficients
+		want float64
+	}{
+		{0x0064, Coefficients{M: 1, B: 0, R: 0}, 100},
+		{0xFFFF, Coefficients{M: 1, B: 0, R: 0}, -1},
+		{0x0064, Coefficients{M: 2, B: 10, R: 1}, 0},
+		{0x012C, Coefficients{M: 2, B: 10, R: 1}, 10},
+		{0x0050, Coefficients{M: 4, B: 0, R: -2}, 2000},
+		{0x0000, Coefficients{M: 0, B: 0, R: 0}, math.NaN()},
+	}
+
+	for _, tt := range tests {
+		got := Direct(tt.raw, tt.c)
+		if math.IsNaN(tt.want) {
+			if !math.IsNaN(got) {
+				t.Errorf("Direct(0x%04X, %+v): got %g, want NaN", tt.raw, tt.c, got)
+			}
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Direct(0x%04X, %+v): got %g, want %g", tt.raw, tt.c, got, tt.want)
+		}
+	}
+}
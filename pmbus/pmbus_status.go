@@ -0,0 +1,115 @@
+package pmbus
+
+// Status holds the STATUS_WORD summary of a PMBus device. The low byte is the
+// same as STATUS_BYTE.
+type Status uint16
+
+// Constants defining the bits of STATUS_WORD.
+const (
+	StatusNoneOfTheAbove Status = 1 << iota
+	StatusCML
+	StatusTemperature
+	StatusVinUVFault
+	StatusIoutOCFault
+	StatusVoutOVFault
+	StatusOff
+	StatusBusy
+	StatusUnknown
+	StatusOther
+	StatusFans
+	StatusPowerGoodNegated
+	StatusMfrSpecific
+	StatusInput
+	StatusIoutPout
+	StatusVout
+)
+
+// statusWordFaults names each bit of STATUS_WORD.
+var statusWordFaults = [16]string{
+	"none of the above",
+	"communication, memory, or logic fault",
+	"temperature fault or warning",
+	"VIN undervoltage fault",
+	"IOUT overcurrent fault",
+	"VOUT overvoltage fault",
+	"unit is off",
+	"device busy",
+	"unknown fault or warning",
+	"other fault or warning",
+	"fan fault or warning",
+	"power good negated",
+	"manufacturer specific fault or warning",
+	"input fault or warning",
+	"IOUT/POUT fault or warning",
+	"VOUT fault or warning",
+}
+
+// Faults returns a description of each fault or warning flagged in s.
+func (s Status) Faults() []string {
+	var f []string
+	for i, name := range statusWordFaults {
+		if 0 != s&(1<<uint(i)) {
+			f = append(f, name)
+		}
+	}
+	return f
+}
+
+// statusDetail associates a detailed status register with the STATUS_WORD bit
+// that summarizes it and the name of each of its bits (indexed by bit number).
+type statusDetail struct {
+	summary Status
+	cmd     Command
+	bits    [8]string
+}
+
+// statusDetails defines the detailed status registers consulted by Faults.
+var statusDetails = []statusDetail{
+	{summary: StatusVout, cmd: CmdStatusVout, bits: [8]string{
+		"VOUT power-on tracking error",
+		"TOFF_MAX warning",
+		"TON_MAX fault",
+		"VOUT_MAX warning",
+		"VOUT undervoltage fault",
+		"VOUT undervoltage warning",
+		"VOUT overvoltage warning",
+		"VOUT overvoltage fault",
+	}},
+	{summary: StatusIoutPout, cmd: CmdStatusIout, bits: [8]string{
+		"POUT overpower warning",
+		"POUT overpower fault",
+		"in power limiting mode",
+		"current share fault",
+		"IOUT undercurrent fault",
+		"IOUT overcurrent warning",
+		"IOUT overcurrent and low voltage fault",
+		"IOUT overcurrent fault",
+	}},
+	{summary: StatusInput, cmd: CmdStatusInput, bits: [8]string{
+		"PIN overpower warning",
+		"IIN overcurrent warning",
+		"IIN overcurrent fault",
+		"unit off for low input voltage",
+		"VIN undervoltage fault",
+		"VIN undervoltage warning",
+		"VIN overvoltage warning",
+		"VIN overvoltage fault",
+	}},
+	{summary: StatusTemperature, cmd: CmdStatusTemperature, bits: [8]string{
+		"", "", "", "",
+		"undertemperature fault",
+		"undertemperature warning",
+		"overtemperature warning",
+		"overtemperature fault",
+	}},
+	{summary: StatusCML, cmd: CmdStatusCML, bits: [8]string{
+		"other memory or logic fault",
+		"other communication fault",
+		"",
+		"processor fault",
+		"memory fault",
+		"packet error check failed",
+		"invalid or unsupported data received",
+		"invalid or unsupported command received",
+	}},
+}